@@ -0,0 +1,107 @@
+package main
+
+import (
+	"time"
+)
+
+type AddrStat struct {
+	Addr                  string
+	LastBlockHeight       int
+	LastBlockHash         string
+	LastBlockTime         int
+	SecondsSinceLastBlock int64
+	LongestDrySpell       int64 // Seconds, window start and now count as the edges of a dry spell
+	LongestDrySpellStart  int64
+	LongestDrySpellEnd    int64
+	WindowBlocks          int
+	WinPercent            float64
+	ExpectedInterval      float64 // Seconds between blocks at the chain's target block time given WinPercent
+}
+
+// Get last block and dry spell information for each address. The dry spell and win percent
+// only look at blocks between startEpoch and endEpoch, the last block can be anywhere in the cache.
+func getAddrStats(addresses []string, startEpoch int64, endEpoch int64) []AddrStat {
+	var addrStats []AddrStat
+	statIndex := make(map[string]int)
+	for _, addr := range addresses {
+		if len(addr) == 0 {
+			continue
+		}
+		if _, ok := statIndex[addr]; ok {
+			continue
+		}
+		statIndex[addr] = len(addrStats)
+		addrStats = append(addrStats, AddrStat{Addr: addr})
+	}
+	if len(addrStats) == 0 {
+		return addrStats
+	}
+
+	now := time.Now().Unix()
+	mutex.Lock()
+	defer mutex.Unlock()
+	lowest, highest := findBlocksForEpochRange(startEpoch, endEpoch)
+
+	// Walk down from the tip until every address has a last block
+	remaining := len(addrStats)
+	for i := currentDBHeight; i >= lowestDBHeight && remaining > 0; i-- {
+		block, ok := blockMap[i]
+		if !ok {
+			continue
+		}
+		index, ok := statIndex[block.Addr]
+		if !ok || addrStats[index].LastBlockHeight > 0 {
+			continue
+		}
+		addrStats[index].LastBlockHeight = block.Height
+		addrStats[index].LastBlockHash = block.Hash
+		addrStats[index].LastBlockTime = block.Time
+		addrStats[index].SecondsSinceLastBlock = now - int64(block.Time)
+		remaining--
+	}
+
+	// Walk up through the window tracking the gaps between blocks for each address
+	lastSeen := make([]int64, len(addrStats))
+	addrCoins := make([]float64, len(addrStats))
+	for index := range addrStats {
+		lastSeen[index] = startEpoch
+	}
+	chainCoins := 0.0
+	for i := lowest; i <= highest; i++ {
+		block, ok := blockMap[i]
+		if !ok || int64(block.Time) < startEpoch || int64(block.Time) >= endEpoch {
+			continue
+		}
+		chainCoins += block.Coins
+		index, ok := statIndex[block.Addr]
+		if !ok {
+			continue
+		}
+		updateDrySpell(&addrStats[index], lastSeen[index], int64(block.Time))
+		lastSeen[index] = int64(block.Time)
+		addrStats[index].WindowBlocks++
+		addrCoins[index] += block.Coins
+	}
+
+	windowEnd := endEpoch
+	if now < windowEnd {
+		windowEnd = now
+	}
+	for index := range addrStats {
+		updateDrySpell(&addrStats[index], lastSeen[index], windowEnd)
+		if addrCoins[index] > 0.1 && chainCoins > 0.1 {
+			addrStats[index].WinPercent = addrCoins[index] * 100.0 / chainCoins
+			addrStats[index].ExpectedInterval = float64(getTargetBlockTime()) * 100.0 / addrStats[index].WinPercent
+		}
+	}
+
+	return addrStats
+}
+
+func updateDrySpell(addrStat *AddrStat, spellStart int64, spellEnd int64) {
+	if spellEnd-spellStart > addrStat.LongestDrySpell {
+		addrStat.LongestDrySpell = spellEnd - spellStart
+		addrStat.LongestDrySpellStart = spellStart
+		addrStat.LongestDrySpellEnd = spellEnd
+	}
+}
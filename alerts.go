@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// The luck rule needs this many of the group's blocks in the baseline before the expected
+// rate means anything
+const minLuckBaselineBlocks = 5
+
+type alertState struct {
+	Firing  bool
+	Since   int64
+	Summary string
+}
+
+// Key is the alert name. Only changes are notified, so an alert that keeps firing notifies once
+// and again when it recovers, across restarts too.
+var alertStates = make(map[string]alertState)
+
+func loadAlertStatesToMemory() {
+	loadedStates := make(map[string]alertState)
+
+	results, err := db.Query("select name, firing, since, summary from alert_states")
+	if err != nil {
+		panic(err.Error())
+	}
+	defer results.Close()
+	for results.Next() {
+		var name string
+		var state alertState
+		if err = results.Scan(&name, &state.Firing, &state.Since, &state.Summary); err != nil {
+			panic(err.Error())
+		}
+		loadedStates[name] = state
+	}
+
+	mutex.Lock()
+	alertStates = loadedStates
+	mutex.Unlock()
+}
+
+// Check the AlertRules and NodeAlerts in the config
+func initAlertRules() {
+	for _, name := range c.NodeAlerts.Notifiers {
+		if _, ok := notifiers[name]; !ok {
+			logger.fatal("NodeAlerts uses an unknown notifier", "notifier", name)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, rule := range c.AlertRules {
+		if rule.Name == "" || names[rule.Name] {
+			logger.fatal("alert rules need a unique Name", "alert", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Type != "no_block" && rule.Type != "win_percent" && rule.Type != "luck" {
+			logger.fatal("unknown alert rule type", "alert", rule.Name, "type", rule.Type)
+		}
+		if rule.Group == "" || rule.Hours <= 0 {
+			logger.fatal("alert rule needs a Group and Hours", "alert", rule.Name)
+		}
+		if rule.Type == "luck" && rule.BaselineHours <= 0 {
+			logger.fatal("alert rule needs BaselineHours", "alert", rule.Name)
+		}
+		for _, name := range rule.Notifiers {
+			if _, ok := notifiers[name]; !ok {
+				logger.fatal("alert rule uses an unknown notifier", "alert", rule.Name, "notifier", name)
+			}
+		}
+	}
+}
+
+// Record whether an alert is firing, notifying when that changes. Notifications are sent in
+// the background so a slow notifier doesn't hold up syncing.
+func setAlertState(name string, notifierNames []string, firing bool, summary string) {
+	now := time.Now().Unix()
+	if len(summary) > 255 {
+		summary = summary[:255]
+	}
+
+	mutex.Lock()
+	state := alertStates[name]
+	if state.Firing == firing {
+		mutex.Unlock()
+		return
+	}
+	if firing {
+		state = alertState{Firing: true, Since: now, Summary: summary}
+	} else {
+		state.Firing = false
+		state.Summary = summary
+	}
+	alertStates[name] = state
+	mutex.Unlock()
+
+	_, err := db.Exec(`
+		INSERT INTO alert_states (name, firing, since, summary) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE firing = VALUES(firing), since = VALUES(since), summary = VALUES(summary)`,
+		name, state.Firing, state.Since, state.Summary)
+	if err != nil {
+		logger.error("unable to save alert state", "alert", name, "error", err)
+	}
+
+	notification := AlertNotification{Alert: name, Firing: firing, Summary: summary, Since: state.Since, Time: now}
+	logger.warn("alert changed", "alert", name, "firing", firing, "summary", summary)
+	go sendNotification(notifierNames, notification)
+}
+
+// Check every alert rule against the blocks in memory, called after each sync
+func evaluateAlerts() {
+	now := time.Now().Unix()
+	for _, rule := range c.AlertRules {
+		addresses, err := getAddrGroupAddresses(rule.Group)
+		if err != nil {
+			logger.warn("skipping alert rule", "alert", rule.Name, "error", err)
+			continue
+		}
+
+		var firing, ok bool
+		var summary string
+		switch rule.Type {
+		case "no_block":
+			firing, summary, ok = evaluateNoBlockRule(rule, addresses, now)
+		case "win_percent":
+			firing, summary, ok = evaluateWinPercentRule(rule, addresses, now)
+		case "luck":
+			firing, summary, ok = evaluateLuckRule(rule, addresses, now)
+		}
+		if ok {
+			setAlertState(rule.Name, rule.Notifiers, firing, summary)
+		}
+	}
+}
+
+// The evaluate functions return ok false when there isn't enough data to say either way
+
+func evaluateNoBlockRule(rule alertRuleConf, addresses string, now int64) (bool, string, bool) {
+	windowStart := now - int64(rule.Hours)*3600
+	lastBlockTime := int64(0)
+	lastBlockHeight := 0
+	for _, addrStat := range getAddrStats(strings.Split(addresses, ","), windowStart, now) {
+		if int64(addrStat.LastBlockTime) > lastBlockTime {
+			lastBlockTime = int64(addrStat.LastBlockTime)
+			lastBlockHeight = addrStat.LastBlockHeight
+		}
+	}
+
+	if lastBlockTime == 0 {
+		return true, fmt.Sprintf("group %s has no blocks in the last %d hours or the cached history", rule.Group, rule.Hours), true
+	}
+	hoursSince := float64(now-lastBlockTime) / 3600.0
+	if lastBlockTime < windowStart {
+		return true, fmt.Sprintf("group %s has no blocks in the last %d hours, the last was %.1f hours ago at height %d",
+			rule.Group, rule.Hours, hoursSince, lastBlockHeight), true
+	}
+	return false, fmt.Sprintf("group %s found block %d %.1f hours ago", rule.Group, lastBlockHeight, hoursSince), true
+}
+
+func evaluateWinPercentRule(rule alertRuleConf, addresses string, now int64) (bool, string, bool) {
+	stat := getCoinStatInEpochRange(now-int64(rule.Hours)*3600, now, addresses)
+	if stat.ChainCoins == 0 {
+		return false, "", false
+	}
+
+	summary := fmt.Sprintf("group %s win percent over the last %d hours is %.2f%%, the threshold is %.2f%%",
+		rule.Group, rule.Hours, stat.WinPercent, rule.Threshold)
+	return stat.WinPercent < rule.Threshold, summary, true
+}
+
+// Fires when the group's block count over Hours is improbably low given its share of the chain's
+// blocks over the BaselineHours before that, treating the count as Poisson
+func evaluateLuckRule(rule alertRuleConf, addresses string, now int64) (bool, string, bool) {
+	confidence := rule.Confidence
+	if confidence <= 0 || confidence >= 1 {
+		confidence = 0.95
+	}
+	windowStart := now - int64(rule.Hours)*3600
+	baselineStart := windowStart - int64(rule.BaselineHours)*3600
+
+	addrs := make(map[string]bool)
+	for _, addr := range strings.Split(addresses, ",") {
+		addrs[addr] = true
+	}
+	baselineChainBlocks, baselineBlocks := countBlocksInEpochRange(baselineStart, windowStart, addrs)
+	windowChainBlocks, windowBlocks := countBlocksInEpochRange(windowStart, now, addrs)
+	if baselineBlocks < minLuckBaselineBlocks || windowChainBlocks == 0 {
+		return false, "", false
+	}
+
+	expected := float64(baselineBlocks) / float64(baselineChainBlocks) * float64(windowChainBlocks)
+	probability := poissonCDF(windowBlocks, expected)
+	summary := fmt.Sprintf("group %s found %d blocks in the last %d hours, %.1f expected from the %d hours before (p=%.4f)",
+		rule.Group, windowBlocks, rule.Hours, expected, rule.BaselineHours, probability)
+	return probability < 1-confidence, summary, true
+}
+
+// Blocks on chain and blocks mined by addrs with startEpoch <= time < endEpoch
+func countBlocksInEpochRange(startEpoch int64, endEpoch int64, addrs map[string]bool) (int, int) {
+	chainBlocks := 0
+	addrBlocks := 0
+	mutex.Lock()
+	defer mutex.Unlock()
+	lowest, highest := findBlocksForEpochRange(startEpoch, endEpoch)
+	for i := lowest; i <= highest; i++ {
+		block, ok := blockMap[i]
+		if !ok || int64(block.Time) < startEpoch || int64(block.Time) >= endEpoch {
+			continue
+		}
+		chainBlocks++
+		if addrs[block.Addr] {
+			addrBlocks++
+		}
+	}
+	return chainBlocks, addrBlocks
+}
+
+// Probability of k or fewer events when lambda are expected
+func poissonCDF(k int, lambda float64) float64 {
+	if k < 0 {
+		return 0
+	}
+	if lambda <= 0 {
+		return 1
+	}
+	// Terms are summed from their logs, e^-lambda alone underflows for large lambda
+	logTerm := -lambda
+	sum := math.Exp(logTerm)
+	for i := 1; i <= k; i++ {
+		logTerm += math.Log(lambda / float64(i))
+		sum += math.Exp(logTerm)
+	}
+	return math.Min(sum, 1)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPoissonCDF(t *testing.T) {
+	tests := []struct {
+		name   string
+		k      int
+		lambda float64
+		want   float64
+	}{
+		{"negative k", -1, 3, 0},
+		{"nothing expected", 0, 0, 1},
+		{"no events with one expected", 0, 1, math.Exp(-1)},
+		{"two or fewer with three expected", 2, 3, math.Exp(-3) * (1 + 3 + 4.5)},
+		{"k far above lambda", 100, 2, 1},
+		{"no events with many expected", 0, 1000, 0},
+	}
+	for _, test := range tests {
+		got := poissonCDF(test.k, test.lambda)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: poissonCDF(%d, %v) = %v, want %v", test.name, test.k, test.lambda, got, test.want)
+		}
+	}
+
+	// e^-lambda underflows here, the sum must still come out near a half
+	if got := poissonCDF(1000, 1000); got < 0.5 || got > 0.52 {
+		t.Errorf("poissonCDF(1000, 1000) = %v, want about 0.508", got)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiKey struct {
+	ID        int
+	Name      string
+	Admin     bool
+	Addresses []string
+	Groups    []string
+}
+
+// Key for the authenticated apiKey in the gin context
+const apiKeyContextKey = "apiKey"
+
+func apiKeysRequired() bool {
+	return c.RequireAPIKey
+}
+
+func hashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func newAPIKeySecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "dmo_" + hex.EncodeToString(secret), nil
+}
+
+// Look up a key and its scopes by the key itself, only the hash is stored
+func getAPIKey(key string) (*apiKey, error) {
+	var thisKey apiKey
+	err := db.QueryRow("select id, name, admin from api_keys where key_hash = ?", hashAPIKey(key)).
+		Scan(&thisKey.ID, &thisKey.Name, &thisKey.Admin)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := db.Query("select scope_type, value from api_key_scopes where key_id = ?", thisKey.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var scopeType, value string
+		if err = results.Scan(&scopeType, &value); err != nil {
+			return nil, err
+		}
+		if scopeType == "group" {
+			thisKey.Groups = append(thisKey.Groups, value)
+		} else {
+			thisKey.Addresses = append(thisKey.Addresses, value)
+		}
+	}
+
+	return &thisKey, nil
+}
+
+func getRequestAPIKeySecret(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); key != "" {
+		return key
+	}
+	// Browsers can't set headers on EventSource or WebSocket requests, so only the stream routes
+	// also take the key in the query string
+	if strings.HasPrefix(c.FullPath(), "/api/v1/stream/") {
+		return c.Query("api_key")
+	}
+	return ""
+}
+
+// Middleware that rejects requests without a valid API key when keys are required
+func apiKeyAuth(c *gin.Context) {
+	if !apiKeysRequired() {
+		c.Next()
+		return
+	}
+
+	secret := getRequestAPIKeySecret(c)
+	if secret == "" {
+		abortWithError(c, http.StatusUnauthorized, errCodeUnauthorized, "api key required")
+		return
+	}
+	thisKey, err := getAPIKey(secret)
+	if err != nil {
+		abortWithError(c, http.StatusUnauthorized, errCodeUnauthorized, "invalid api key")
+		return
+	}
+
+	c.Set(apiKeyContextKey, thisKey)
+	c.Next()
+}
+
+// Management endpoints are refused when API keys are off, unless the config opts in, since they let
+// the caller register URLs the service will send requests to
+func adminWithoutAPIKeyAllowed() bool {
+	return c.AdminWithoutAPIKey
+}
+
+// Middleware for management endpoints, must come after apiKeyAuth
+func requireAdmin(c *gin.Context) {
+	if !apiKeysRequired() {
+		if !adminWithoutAPIKeyAllowed() {
+			abortWithError(c, http.StatusForbidden, errCodeForbidden, "management endpoints need RequireAPIKey and an admin api key")
+			return
+		}
+		c.Next()
+		return
+	}
+
+	if thisKey := getContextAPIKey(c); thisKey == nil || !thisKey.Admin {
+		abortWithError(c, http.StatusForbidden, errCodeForbidden, "admin api key required")
+		return
+	}
+	c.Next()
+}
+
+// Middleware for /metrics, open when API keys are off and admin only when they are on
+func requireMetricsAccess(c *gin.Context) {
+	if !apiKeysRequired() {
+		c.Next()
+		return
+	}
+	requireAdmin(c)
+}
+
+func getContextAPIKey(c *gin.Context) *apiKey {
+	value, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return nil
+	}
+	return value.(*apiKey)
+}
+
+// Check the request's key may see stats for a group, or for a list of addresses when group is empty.
+// Always allowed when keys are not required.
+func apiKeyAllows(c *gin.Context, group string, addrs []string) bool {
+	if !apiKeysRequired() {
+		return true
+	}
+	thisKey := getContextAPIKey(c)
+	if thisKey == nil {
+		return false
+	}
+	if thisKey.Admin {
+		return true
+	}
+	if group != "" && contains(thisKey.Groups, group) {
+		return true
+	}
+
+	allowedAddrs := make(map[string]bool)
+	for _, addr := range thisKey.Addresses {
+		allowedAddrs[addr] = true
+	}
+	for _, name := range thisKey.Groups {
+		if scopedGroup, ok := getAddrGroup(name); ok {
+			for _, member := range scopedGroup.Members {
+				allowedAddrs[member.Address] = true
+			}
+		}
+	}
+	for _, addr := range addrs {
+		if len(addr) > 0 && !allowedAddrs[addr] {
+			return false
+		}
+	}
+	return true
+}
+
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Manage API keys from the command line:
+//
+//	dmo-statservice apikey create -name NAME [-admin] [-addresses a,b] [-groups g1,g2]
+//	dmo-statservice apikey list
+//	dmo-statservice apikey revoke -name NAME
+func runAPIKeyCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s apikey create|list|revoke [flags]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("apikey create", flag.ExitOnError)
+		name := flags.String("name", "", "name for the key")
+		admin := flags.Bool("admin", false, "allow access to all addresses and management endpoints")
+		addresses := flags.String("addresses", "", "comma separated addresses the key may query")
+		groups := flags.String("groups", "", "comma separated address groups the key may query")
+		flags.Parse(args[1:])
+		if *name == "" {
+			log.Fatalf("apikey create needs -name")
+		}
+		var addrs []string
+		for _, addr := range splitList(*addresses) {
+			if err := validateDMOAddress(addr); err != nil {
+				log.Fatalf("Invalid address %q: %s", addr, err)
+			}
+			addrs = append(addrs, normalizeDMOAddress(addr))
+		}
+		secret, err := createAPIKey(*name, *admin, addrs, splitList(*groups))
+		if err != nil {
+			log.Fatalf("Unable to create api key: %s", err)
+		}
+		fmt.Printf("Created api key %s, it will not be shown again:\n%s\n", *name, secret)
+	case "list":
+		listAPIKeys()
+	case "revoke":
+		flags := flag.NewFlagSet("apikey revoke", flag.ExitOnError)
+		name := flags.String("name", "", "name of the key to revoke")
+		flags.Parse(args[1:])
+		if err := revokeAPIKey(*name); err != nil {
+			log.Fatalf("Unable to revoke api key: %s", err)
+		}
+		fmt.Printf("Revoked api key %s\n", *name)
+	default:
+		log.Fatalf("Unknown apikey command: %s", args[0])
+	}
+}
+
+func createAPIKey(name string, admin bool, addresses []string, groups []string) (string, error) {
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO api_keys (name, key_hash, admin, created) VALUES (?, ?, ?, ?)",
+		name, hashAPIKey(secret), admin, time.Now().Unix())
+	if err != nil {
+		return "", err
+	}
+	keyID, err := result.LastInsertId()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addresses {
+		if _, err = tx.Exec("INSERT IGNORE INTO api_key_scopes (key_id, scope_type, value) VALUES (?, 'address', ?)", keyID, addr); err != nil {
+			return "", err
+		}
+	}
+	for _, group := range groups {
+		if _, err = tx.Exec("INSERT IGNORE INTO api_key_scopes (key_id, scope_type, value) VALUES (?, 'group', ?)", keyID, group); err != nil {
+			return "", err
+		}
+	}
+
+	return secret, tx.Commit()
+}
+
+func listAPIKeys() {
+	results, err := db.Query(`
+		select k.name, k.admin, k.created, s.scope_type, s.value
+		from api_keys k left join api_key_scopes s on s.key_id = k.id
+		order by k.name, s.scope_type, s.value`)
+	if err != nil {
+		log.Fatalf("Unable to list api keys: %s", err)
+	}
+	defer results.Close()
+
+	for results.Next() {
+		var name string
+		var admin bool
+		var created int64
+		var scopeType, value *string
+		if err = results.Scan(&name, &admin, &created, &scopeType, &value); err != nil {
+			log.Fatalf("Unable to list api keys: %s", err)
+		}
+		scope := "-"
+		if scopeType != nil && value != nil {
+			scope = *scopeType + ":" + *value
+		}
+		fmt.Printf("%s\tadmin=%t\tcreated=%s\t%s\n", name, admin, time.Unix(created, 0).UTC().Format(time.RFC3339), scope)
+	}
+}
+
+func revokeAPIKey(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE s FROM api_key_scopes s JOIN api_keys k ON k.id = s.key_id WHERE k.name = ?", name); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM api_keys WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return fmt.Errorf("no api key named %s", name)
+	}
+
+	return tx.Commit()
+}
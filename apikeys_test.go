@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetRequestAPIKeySecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		header string
+		want   string
+	}{
+		{"header", "/api/v1/stats", "secret", "secret"},
+		{"query on a stats route", "/api/v1/stats?api_key=secret", "", ""},
+		{"query on the sse stream", "/api/v1/stream/sse?api_key=secret", "", "secret"},
+		{"query on the websocket stream", "/api/v1/stream/ws?api_key=secret", "", "secret"},
+		{"header wins over query", "/api/v1/stream/sse?api_key=other", "secret", "secret"},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	var got string
+	record := func(c *gin.Context) { got = getRequestAPIKeySecret(c) }
+	for _, path := range []string{"/api/v1/stats", "/api/v1/stream/sse", "/api/v1/stream/ws"} {
+		router.GET(path, record)
+	}
+
+	for _, test := range tests {
+		got = ""
+		request := httptest.NewRequest(http.MethodGet, test.url, nil)
+		if test.header != "" {
+			request.Header.Set("X-API-Key", test.header)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), request)
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
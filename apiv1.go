@@ -0,0 +1,341 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The /api/v1 types are the stable, snake_case, form of the legacy responses. Fields may be
+// added but never renamed or removed, the legacy routes keep the Go field names.
+
+type miningStatsRequestV1 struct {
+	Addresses string `json:"addresses" form:"addresses"`
+	Group     string `json:"group" form:"group"`
+	NumDays   int    `json:"num_days" form:"num_days"`
+	TimeZone  string `json:"time_zone" form:"time_zone"`
+}
+
+type blockTimeStatsRequestV1 struct {
+	NumDays  int    `json:"num_days" form:"num_days"`
+	TimeZone string `json:"time_zone" form:"time_zone"`
+}
+
+type CoinStatV1 struct {
+	Coins      float64            `json:"coins"`
+	SoloCoins  float64            `json:"solo_coins"`
+	PoolCoins  map[string]float64 `json:"pool_coins"`
+	ChainCoins float64            `json:"chain_coins"`
+	WinPercent float64            `json:"win_percent"`
+	FiatValue  float64            `json:"fiat_value"`
+	BTCValue   float64            `json:"btc_value"`
+}
+
+type HourStatV1 struct {
+	Hour int `json:"hour"`
+	CoinStatV1
+}
+
+type DayStatV1 struct {
+	Day string `json:"day"`
+	CoinStatV1
+}
+
+type AddrStatV1 struct {
+	Addr                  string  `json:"address"`
+	LastBlockHeight       int     `json:"last_block_height"`
+	LastBlockHash         string  `json:"last_block_hash"`
+	LastBlockTime         int     `json:"last_block_time"`
+	SecondsSinceLastBlock int64   `json:"seconds_since_last_block"`
+	LongestDrySpell       int64   `json:"longest_dry_spell"`
+	LongestDrySpellStart  int64   `json:"longest_dry_spell_start"`
+	LongestDrySpellEnd    int64   `json:"longest_dry_spell_end"`
+	WindowBlocks          int     `json:"window_blocks"`
+	WinPercent            float64 `json:"win_percent"`
+	ExpectedInterval      float64 `json:"expected_interval"`
+}
+
+type PoolAddrStatusV1 struct {
+	Provider           string `json:"provider"`
+	Addr               string `json:"address"`
+	LastUpdate         int64  `json:"last_update"`
+	SecondsSinceUpdate int64  `json:"seconds_since_update"`
+	Stale              bool   `json:"stale"`
+	LastError          string `json:"last_error"`
+}
+
+type MiningStatsV1 struct {
+	HourlyStats         []HourStatV1       `json:"hourly_stats"`
+	DailyStats          []DayStatV1        `json:"daily_stats"`
+	ProjectedCoinsToday float64            `json:"projected_coins_today"`
+	NetHash             float64            `json:"net_hash"`
+	AddressStats        []AddrStatV1       `json:"address_stats"`
+	FiatCurrency        string             `json:"fiat_currency"`
+	PoolStatus          []PoolAddrStatusV1 `json:"pool_status"`
+}
+
+type IntervalStatV1 struct {
+	NumBlocks           int     `json:"num_blocks"`
+	AvgInterval         float64 `json:"avg_interval"`
+	MedianInterval      float64 `json:"median_interval"`
+	LongestInterval     int     `json:"longest_interval"`
+	BlocksPerHour       float64 `json:"blocks_per_hour"`
+	TargetBlocksPerHour float64 `json:"target_blocks_per_hour"`
+}
+
+type HourIntervalStatV1 struct {
+	Hour int `json:"hour"`
+	IntervalStatV1
+}
+
+type DayIntervalStatV1 struct {
+	Day string `json:"day"`
+	IntervalStatV1
+}
+
+type IntervalHistogramBucketV1 struct {
+	MinSeconds int `json:"min_seconds"`
+	MaxSeconds int `json:"max_seconds"`
+	Count      int `json:"count"`
+}
+
+type BlockGapV1 struct {
+	StartHeight int `json:"start_height"`
+	EndHeight   int `json:"end_height"`
+	StartTime   int `json:"start_time"`
+	EndTime     int `json:"end_time"`
+	Seconds     int `json:"seconds"`
+}
+
+type BlockTimeStatsV1 struct {
+	HourlyStats     []HourIntervalStatV1        `json:"hourly_stats"`
+	DailyStats      []DayIntervalStatV1         `json:"daily_stats"`
+	WindowStats     IntervalStatV1              `json:"window_stats"`
+	Histogram       []IntervalHistogramBucketV1 `json:"histogram"`
+	LongestGaps     []BlockGapV1                `json:"longest_gaps"`
+	TargetBlockTime int                         `json:"target_block_time"`
+}
+
+type GroupMemberV1 struct {
+	Address string `json:"address"`
+	Label   string `json:"label"`
+}
+
+type AddrGroupV1 struct {
+	Name    string          `json:"name"`
+	Members []GroupMemberV1 `json:"members"`
+}
+
+type addrGroupRequestV1 struct {
+	Members []GroupMemberV1 `json:"members"`
+}
+
+type GroupWebhookV1 struct {
+	ID      int    `json:"id"`
+	Group   string `json:"group"`
+	URL     string `json:"url"`
+	Secret  string `json:"secret,omitempty"`
+	Created int64  `json:"created"`
+}
+
+type groupWebhookRequestV1 struct {
+	URL string `json:"url"`
+}
+
+func miningStatsToV1(stats MiningStats) MiningStatsV1 {
+	statsV1 := MiningStatsV1{
+		HourlyStats:         make([]HourStatV1, 0, len(stats.HourlyStats)),
+		DailyStats:          make([]DayStatV1, 0, len(stats.DailyStats)),
+		ProjectedCoinsToday: stats.ProjectedCoinsToday,
+		NetHash:             stats.NetHash,
+		AddressStats:        make([]AddrStatV1, 0, len(stats.AddressStats)),
+		FiatCurrency:        stats.FiatCurrency,
+		PoolStatus:          make([]PoolAddrStatusV1, 0, len(stats.PoolStatus)),
+	}
+	for _, hourStat := range stats.HourlyStats {
+		statsV1.HourlyStats = append(statsV1.HourlyStats, HourStatV1{Hour: hourStat.Hour, CoinStatV1: CoinStatV1(hourStat.CoinStat)})
+	}
+	for _, dayStat := range stats.DailyStats {
+		statsV1.DailyStats = append(statsV1.DailyStats, DayStatV1{Day: dayStat.Day, CoinStatV1: CoinStatV1(dayStat.CoinStat)})
+	}
+	for _, addrStat := range stats.AddressStats {
+		statsV1.AddressStats = append(statsV1.AddressStats, AddrStatV1(addrStat))
+	}
+	for _, poolStatus := range stats.PoolStatus {
+		statsV1.PoolStatus = append(statsV1.PoolStatus, PoolAddrStatusV1(poolStatus))
+	}
+	return statsV1
+}
+
+func blockTimeStatsToV1(stats BlockTimeStats) BlockTimeStatsV1 {
+	statsV1 := BlockTimeStatsV1{
+		HourlyStats:     make([]HourIntervalStatV1, 0, len(stats.HourlyStats)),
+		DailyStats:      make([]DayIntervalStatV1, 0, len(stats.DailyStats)),
+		WindowStats:     IntervalStatV1(stats.WindowStats),
+		Histogram:       make([]IntervalHistogramBucketV1, 0, len(stats.Histogram)),
+		LongestGaps:     make([]BlockGapV1, 0, len(stats.LongestGaps)),
+		TargetBlockTime: stats.TargetBlockTime,
+	}
+	for _, hourStat := range stats.HourlyStats {
+		statsV1.HourlyStats = append(statsV1.HourlyStats, HourIntervalStatV1{Hour: hourStat.Hour, IntervalStatV1: IntervalStatV1(hourStat.IntervalStat)})
+	}
+	for _, dayStat := range stats.DailyStats {
+		statsV1.DailyStats = append(statsV1.DailyStats, DayIntervalStatV1{Day: dayStat.Day, IntervalStatV1: IntervalStatV1(dayStat.IntervalStat)})
+	}
+	for _, bucket := range stats.Histogram {
+		statsV1.Histogram = append(statsV1.Histogram, IntervalHistogramBucketV1(bucket))
+	}
+	for _, gap := range stats.LongestGaps {
+		statsV1.LongestGaps = append(statsV1.LongestGaps, BlockGapV1(gap))
+	}
+	return statsV1
+}
+
+func addrGroupToV1(group AddrGroup) AddrGroupV1 {
+	groupV1 := AddrGroupV1{Name: group.Name, Members: make([]GroupMemberV1, 0, len(group.Members))}
+	for _, member := range group.Members {
+		groupV1.Members = append(groupV1.Members, GroupMemberV1(member))
+	}
+	return groupV1
+}
+
+func getMiningStatsV1RPC(c *gin.Context) {
+	var request miningStatsRequestV1
+	if err := bindStatsRequest(c, &request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	stats, ok := getMiningStats(c, mineRPC(request))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, miningStatsToV1(stats))
+}
+
+func getBlockTimeStatsV1RPC(c *gin.Context) {
+	var request blockTimeStatsRequestV1
+	if err := bindStatsRequest(c, &request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	stats, ok := getBlockTimeStats(c, blockTimeRPC(request))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, blockTimeStatsToV1(stats))
+}
+
+func listAddrGroupsV1RPC(c *gin.Context) {
+	groups := listAddrGroups()
+	groupsV1 := make([]AddrGroupV1, 0, len(groups))
+	for _, group := range groups {
+		groupsV1 = append(groupsV1, addrGroupToV1(group))
+	}
+
+	c.JSON(http.StatusOK, groupsV1)
+}
+
+func getAddrGroupV1RPC(c *gin.Context) {
+	group, ok := getAddrGroup(c.Param("name"))
+	if !ok {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, addrGroupToV1(group))
+}
+
+func putAddrGroupV1RPC(c *gin.Context) {
+	var request addrGroupRequestV1
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	members := make([]GroupMember, 0, len(request.Members))
+	for _, member := range request.Members {
+		members = append(members, GroupMember(member))
+	}
+	group, ok := putAddrGroup(c, c.Param("name"), members)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, addrGroupToV1(group))
+}
+
+func listGroupWebhooksV1RPC(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := getAddrGroup(name); !ok {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+		return
+	}
+
+	webhooks := listGroupWebhooks(name)
+	webhooksV1 := make([]GroupWebhookV1, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		webhooksV1 = append(webhooksV1, GroupWebhookV1(webhook))
+	}
+	c.JSON(http.StatusOK, webhooksV1)
+}
+
+func createGroupWebhookV1RPC(c *gin.Context) {
+	var request groupWebhookRequestV1
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	webhook, ok := createGroupWebhookRequest(c, c.Param("name"), request.URL)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, GroupWebhookV1(webhook))
+}
+
+func getOpenAPIV1RPC(c *gin.Context) {
+	c.JSON(http.StatusOK, buildOpenAPISpec("/api/v1", getAPIV1Routes()))
+}
+
+// Every /api/v1 route. The OpenAPI document is generated from this table, so a route's Params and
+// Response must be the types its handler actually binds and returns.
+func getAPIV1Routes() []apiRoute {
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/mining-stats", Summary: "Mining stats for addresses or an address group", Handler: getMiningStatsV1RPC, Params: miningStatsRequestV1{}, Response: MiningStatsV1{}},
+		{Method: http.MethodPost, Path: "/mining-stats", Summary: "Mining stats for addresses or an address group", Handler: getMiningStatsV1RPC, Params: miningStatsRequestV1{}, Response: MiningStatsV1{}},
+		{Method: http.MethodGet, Path: "/block-time-stats", Summary: "Block time and inter-block interval stats", Handler: getBlockTimeStatsV1RPC, Params: blockTimeStatsRequestV1{}, Response: BlockTimeStatsV1{}},
+		{Method: http.MethodPost, Path: "/block-time-stats", Summary: "Block time and inter-block interval stats", Handler: getBlockTimeStatsV1RPC, Params: blockTimeStatsRequestV1{}, Response: BlockTimeStatsV1{}},
+		{Method: http.MethodGet, Path: "/history", Summary: "Hourly or daily mined blocks, solo and pool coins and their value over any range, including blocks compacted into rollups", Handler: getHistoryV1RPC, Params: historyRequestV1{}, Response: HistoryV1{}},
+		{Method: http.MethodPost, Path: "/history", Summary: "Hourly or daily mined blocks, solo and pool coins and their value over any range, including blocks compacted into rollups", Handler: getHistoryV1RPC, Params: historyRequestV1{}, Response: HistoryV1{}},
+		{Method: http.MethodGet, Path: "/groups", Summary: "List address groups", Handler: listAddrGroupsV1RPC, Response: []AddrGroupV1{}, Admin: true},
+		{Method: http.MethodGet, Path: "/groups/:name", Summary: "Get an address group", Handler: getAddrGroupV1RPC, Response: AddrGroupV1{}, Admin: true},
+		{Method: http.MethodPut, Path: "/groups/:name", Summary: "Create or replace an address group", Handler: putAddrGroupV1RPC, Params: addrGroupRequestV1{}, Response: AddrGroupV1{}, Admin: true},
+		{Method: http.MethodDelete, Path: "/groups/:name", Summary: "Delete an address group", Handler: deleteAddrGroupRPC, Admin: true},
+		{Method: http.MethodGet, Path: "/groups/:name/webhooks", Summary: "List the webhooks notified when a group's addresses mine a block", Handler: listGroupWebhooksV1RPC, Response: []GroupWebhookV1{}, Admin: true},
+		{Method: http.MethodPost, Path: "/groups/:name/webhooks", Summary: "Add a webhook to a group, the response has the signing secret which is not shown again", Handler: createGroupWebhookV1RPC, Params: groupWebhookRequestV1{}, Response: GroupWebhookV1{}, Status: http.StatusCreated, Admin: true},
+		{Method: http.MethodDelete, Path: "/groups/:name/webhooks/:id", Summary: "Delete a group webhook and its queued deliveries", Handler: deleteGroupWebhookRPC, Admin: true},
+		{Method: http.MethodGet, Path: "/backfill", Summary: "Progress of the running or last backfill", Handler: getBackfillV1RPC, Response: BackfillStatusV1{}, Admin: true},
+		{Method: http.MethodPost, Path: "/backfill", Summary: "Start filling the heights missing from the DB in a range in the background, 409 if a backfill is running", Handler: startBackfillV1RPC, Params: backfillRequestV1{}, Response: BackfillStatusV1{}, Status: http.StatusAccepted, Admin: true},
+		{Method: http.MethodDelete, Path: "/backfill", Summary: "Stop the running backfill, blocks stored so far are kept", Handler: cancelBackfillV1RPC, Admin: true},
+		{Method: http.MethodGet, Path: "/backfill/gaps", Summary: "Height ranges missing from the DB", Handler: getBackfillGapsV1RPC, Params: backfillRequestV1{}, Response: BackfillGapsV1{}, Admin: true},
+		{Method: http.MethodGet, Path: "/stream/sse", Summary: "Server-Sent Events feed of new blocks (block events) and per sync stats deltas (stats events), the api key can be passed as api_key for EventSource", Handler: streamSSEV1RPC, Params: streamRequestV1{}, Response: StreamEventV1{}, ContentType: "text/event-stream"},
+		{Method: http.MethodGet, Path: "/stream/ws", Summary: "WebSocket feed of the same events as /stream/sse, each message is a json StreamEvent, the api key can be passed as api_key for browsers", Handler: streamWebSocketV1RPC, Params: streamRequestV1{}, Response: StreamEventV1{}},
+		{Method: http.MethodGet, Path: "/openapi.json", Summary: "This OpenAPI document", Handler: getOpenAPIV1RPC, Response: map[string]interface{}{}},
+	}
+}
+
+func registerAPIV1Routes(router *gin.Engine) {
+	v1 := router.Group("/api/v1")
+	for _, route := range getAPIV1Routes() {
+		if route.Admin {
+			v1.Handle(route.Method, route.Path, requireAdmin, route.Handler)
+		} else {
+			v1.Handle(route.Method, route.Path, route.Handler)
+		}
+	}
+}
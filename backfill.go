@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Backfill fetches heights missing from the stats table, from genesis onward if asked, while the tip
+// sync carries on. Blocks go through storeBlocks like synced ones, so a height filled twice is
+// harmless. Heights above the synced tip are left to the tip sync.
+
+// Gap lists are cut off after this many ranges
+const maxListedGaps = 1000
+
+// Log backfill progress every this many blocks
+const backfillLogInterval = 1000
+
+var errBackfillRunning = errors.New("a backfill is already running")
+
+// Inclusive range of heights
+type HeightRangeV1 struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type backfillRequestV1 struct {
+	From int `json:"from" form:"from"`
+	To   int `json:"to" form:"to"` // 0 means the highest stored height
+}
+
+type BackfillStatusV1 struct {
+	Running         bool    `json:"running"`
+	From            int     `json:"from"`
+	To              int     `json:"to"`
+	Gaps            int     `json:"gaps"` // Missing ranges found when the backfill started
+	GapsRemaining   int     `json:"gaps_remaining"`
+	BlocksTotal     int     `json:"blocks_total"`
+	BlocksDone      int     `json:"blocks_done"`
+	Height          int     `json:"height"` // Last height stored
+	BlocksPerSecond float64 `json:"blocks_per_second"`
+	ETASeconds      int64   `json:"eta_seconds"`
+	StartedAt       int64   `json:"started_at"`
+	FinishedAt      int64   `json:"finished_at"`
+	Error           string  `json:"error,omitempty"`
+}
+
+type BackfillGapsV1 struct {
+	From          int             `json:"from"`
+	To            int             `json:"to"`
+	MissingBlocks int             `json:"missing_blocks"`
+	Gaps          []HeightRangeV1 `json:"gaps"`
+	Truncated     bool            `json:"truncated"` // More than maxListedGaps gaps
+}
+
+var (
+	backfillMutex  sync.Mutex
+	backfillStatus BackfillStatusV1
+	backfillCancel context.CancelFunc
+	// Set by initBackfill so backfills started from the API stop on shutdown
+	backfillCtx        context.Context
+	backfillBackground *sync.WaitGroup
+)
+
+func initBackfill(ctx context.Context, background *sync.WaitGroup) {
+	backfillCtx = ctx
+	backfillBackground = background
+}
+
+// Heights between from and to that are neither in the stats table nor compacted into stats_hourly
+func findHeightGaps(from int, to int) ([]HeightRangeV1, error) {
+	var gaps []HeightRangeV1
+	next := from
+	results, err := db.Query("SELECT height_id FROM stats WHERE height_id >= ? AND height_id <= ? ORDER BY height_id", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+	for results.Next() {
+		var height int
+		if err = results.Scan(&height); err != nil {
+			return nil, err
+		}
+		gaps, next = addHeightGap(gaps, next, height)
+	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+	gaps, _ = addHeightGap(gaps, next, to+1)
+	if len(gaps) == 0 {
+		return gaps, nil
+	}
+
+	compacted, err := db.Query("SELECT start_height, end_height FROM compacted_ranges WHERE end_height >= ? AND start_height <= ? ORDER BY start_height", from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer compacted.Close()
+	for compacted.Next() {
+		var done HeightRangeV1
+		if err = compacted.Scan(&done.From, &done.To); err != nil {
+			return nil, err
+		}
+		gaps = subtractHeightRange(gaps, done)
+	}
+	return gaps, compacted.Err()
+}
+
+// Add the missing heights from next up to a stored height to gaps, returns the height expected next
+func addHeightGap(gaps []HeightRangeV1, next int, height int) ([]HeightRangeV1, int) {
+	if height > next {
+		gaps = append(gaps, HeightRangeV1{From: next, To: height - 1})
+	}
+	return gaps, height + 1
+}
+
+// Remove the heights in done from the sorted gaps
+func subtractHeightRange(gaps []HeightRangeV1, done HeightRangeV1) []HeightRangeV1 {
+	var remaining []HeightRangeV1
+	for _, gap := range gaps {
+		if done.To < gap.From || done.From > gap.To {
+			remaining = append(remaining, gap)
+			continue
+		}
+		if done.From > gap.From {
+			remaining = append(remaining, HeightRangeV1{From: gap.From, To: done.From - 1})
+		}
+		if done.To < gap.To {
+			remaining = append(remaining, HeightRangeV1{From: done.To + 1, To: gap.To})
+		}
+	}
+	return remaining
+}
+
+func countGapBlocks(gaps []HeightRangeV1) int {
+	blocks := 0
+	for _, gap := range gaps {
+		blocks += gap.To - gap.From + 1
+	}
+	return blocks
+}
+
+// Check a backfill range, a to of 0 or above the synced tip is lowered to the tip
+func resolveBackfillRange(from int, to int) (int, int, error) {
+	mutex.Lock()
+	tip := currentDBHeight
+	mutex.Unlock()
+	if to == 0 || to > tip {
+		to = tip
+	}
+	if from < 0 {
+		return 0, 0, fmt.Errorf("from can't be negative")
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("from must be at most to, the highest stored height is %d", tip)
+	}
+	return from, to, nil
+}
+
+func getBackfillStatus() BackfillStatusV1 {
+	backfillMutex.Lock()
+	defer backfillMutex.Unlock()
+	return backfillStatus
+}
+
+// Start a backfill in the background, only one runs at a time
+func startBackfill(from int, to int) (BackfillStatusV1, error) {
+	backfillMutex.Lock()
+	defer backfillMutex.Unlock()
+	if backfillStatus.Running {
+		return backfillStatus, errBackfillRunning
+	}
+
+	ctx, cancel := context.WithCancel(backfillCtx)
+	backfillCancel = cancel
+	backfillStatus = BackfillStatusV1{Running: true, From: from, To: to, StartedAt: time.Now().Unix()}
+	runInBackground(ctx, backfillBackground, func(ctx context.Context) {
+		defer cancel()
+		runBackfill(ctx, from, to)
+	})
+	return backfillStatus, nil
+}
+
+// Stop the running backfill, false if none is running
+func cancelBackfill() bool {
+	backfillMutex.Lock()
+	defer backfillMutex.Unlock()
+	if !backfillStatus.Running {
+		return false
+	}
+	backfillCancel()
+	return true
+}
+
+// Find the gaps between from and to and fill them, keeping backfillStatus up to date
+func runBackfill(ctx context.Context, from int, to int) {
+	backfillMutex.Lock()
+	backfillStatus = BackfillStatusV1{Running: true, From: from, To: to, StartedAt: time.Now().Unix()}
+	backfillMutex.Unlock()
+
+	err := fillHeightGaps(ctx, from, to)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	backfillMutex.Lock()
+	backfillStatus.Running = false
+	backfillStatus.FinishedAt = time.Now().Unix()
+	backfillStatus.ETASeconds = 0
+	if err != nil {
+		backfillStatus.Error = err.Error()
+	}
+	status := backfillStatus
+	backfillMutex.Unlock()
+
+	if err != nil {
+		logger.error("backfill stopped", "from", from, "to", to, "blocks", status.BlocksDone, "error", err)
+		return
+	}
+	logger.info("backfill complete", "from", from, "to", to, "blocks", status.BlocksDone, "gaps_remaining", status.GapsRemaining)
+}
+
+func fillHeightGaps(ctx context.Context, from int, to int) error {
+	gaps, err := findHeightGaps(from, to)
+	if err != nil {
+		return err
+	}
+	total := countGapBlocks(gaps)
+	backfillMutex.Lock()
+	backfillStatus.Gaps = len(gaps)
+	backfillStatus.GapsRemaining = len(gaps)
+	backfillStatus.BlocksTotal = total
+	backfillMutex.Unlock()
+	logger.info("backfill starting", "from", from, "to", to, "gaps", len(gaps), "blocks", total)
+
+	start := time.Now()
+	done := 0
+	var batch []blockInformation
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := storeBlocks(batch, false); err != nil {
+			return err
+		}
+		cacheRetainedBlocks(batch)
+		if done/backfillLogInterval != (done+len(batch))/backfillLogInterval {
+			logger.info("backfilled blocks", "height", batch[len(batch)-1].Height, "done", done+len(batch), "total", total)
+		}
+		done += len(batch)
+
+		rate := float64(done) / time.Since(start).Seconds()
+		backfillMutex.Lock()
+		backfillStatus.BlocksDone = done
+		backfillStatus.Height = batch[len(batch)-1].Height
+		backfillStatus.BlocksPerSecond = rate
+		if rate > 0 {
+			backfillStatus.ETASeconds = int64(float64(total-done) / rate)
+		}
+		backfillMutex.Unlock()
+		batch = nil
+		return nil
+	}
+
+	for _, gap := range gaps {
+		for height := gap.From; height <= gap.To; height++ {
+			if ctx.Err() != nil {
+				return flush()
+			}
+			block, err := getFullBlockInfoForHeight(height)
+			if err != nil {
+				if flushErr := flush(); flushErr != nil {
+					return flushErr
+				}
+				return fmt.Errorf("reading block %d from node: %w", height, err)
+			}
+			batch = append(batch, block)
+			if len(batch) >= syncBatchSize {
+				if err := flush(); err != nil {
+					return fmt.Errorf("storing blocks from height %d: %w", batch[0].Height, err)
+				}
+			}
+		}
+		if err := flush(); err != nil {
+			return fmt.Errorf("storing blocks from height %d: %w", batch[0].Height, err)
+		}
+	}
+
+	remaining, err := findHeightGaps(from, to)
+	if err != nil {
+		return err
+	}
+	backfillMutex.Lock()
+	backfillStatus.GapsRemaining = len(remaining)
+	backfillMutex.Unlock()
+	return nil
+}
+
+// Backfilled blocks only go into memory when they are within the memory retention. Streams and
+// webhooks are for new blocks, so they aren't told.
+func cacheRetainedBlocks(blocks []blockInformation) {
+	cutoff := getMemoryRetentionStart()
+	var retained []blockInformation
+	for _, block := range blocks {
+		if int64(block.Time) >= cutoff {
+			retained = append(retained, block)
+		}
+	}
+	if len(retained) > 0 {
+		cacheBlocks(retained)
+	}
+}
+
+func getBackfillV1RPC(c *gin.Context) {
+	c.JSON(http.StatusOK, getBackfillStatus())
+}
+
+func startBackfillV1RPC(c *gin.Context) {
+	var request backfillRequestV1
+	if err := c.ShouldBindJSON(&request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	from, to, err := resolveBackfillRange(request.From, request.To)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidRange, err.Error())
+		return
+	}
+	if backfillCtx.Err() != nil {
+		abortWithError(c, http.StatusServiceUnavailable, errCodeUnavailable, "service is shutting down")
+		return
+	}
+
+	status, err := startBackfill(from, to)
+	if err == errBackfillRunning {
+		abortWithError(c, http.StatusConflict, errCodeConflict, err.Error())
+		return
+	}
+	requestLog(c).info("backfill requested", "from", from, "to", to)
+	c.JSON(http.StatusAccepted, status)
+}
+
+func cancelBackfillV1RPC(c *gin.Context) {
+	if !cancelBackfill() {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "no backfill is running")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func getBackfillGapsV1RPC(c *gin.Context) {
+	var request backfillRequestV1
+	if err := c.ShouldBindQuery(&request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+	from, to, err := resolveBackfillRange(request.From, request.To)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidRange, err.Error())
+		return
+	}
+
+	gaps, err := findHeightGaps(from, to)
+	if err != nil {
+		requestLog(c).error("unable to find gaps", "error", err)
+		abortWithError(c, http.StatusInternalServerError, errCodeInternal, "unable to find gaps")
+		return
+	}
+	response := BackfillGapsV1{From: from, To: to, MissingBlocks: countGapBlocks(gaps), Gaps: gaps}
+	if len(gaps) > maxListedGaps {
+		response.Gaps = gaps[:maxListedGaps]
+		response.Truncated = true
+	}
+	if response.Gaps == nil {
+		response.Gaps = []HeightRangeV1{}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ./dmo-statservice backfill [-from N] [-to N] [-gaps], runs in the foreground until done. A running
+// service keeps syncing the tip meanwhile.
+func runBackfillCommand(ctx context.Context, args []string) {
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	from := flags.Int("from", 0, "first height to fill, 0 is genesis")
+	to := flags.Int("to", 0, "last height to fill, 0 is the highest stored height")
+	listGaps := flags.Bool("gaps", false, "only list the missing height ranges")
+	flags.Parse(args)
+
+	if err := getDBHeight(); err != nil {
+		log.Fatalf("Unable to read the DB height: %s", err)
+	}
+	first, last, err := resolveBackfillRange(*from, *to)
+	if err != nil {
+		log.Fatalf("Invalid range: %s", err)
+	}
+
+	if *listGaps {
+		gaps, err := findHeightGaps(first, last)
+		if err != nil {
+			log.Fatalf("Unable to find gaps: %s", err)
+		}
+		for _, gap := range gaps {
+			fmt.Printf("%d-%d\t%d blocks\n", gap.From, gap.To, gap.To-gap.From+1)
+		}
+		fmt.Printf("%d blocks missing between %d and %d\n", countGapBlocks(gaps), first, last)
+		return
+	}
+
+	runBackfill(ctx, first, last)
+	status := getBackfillStatus()
+	fmt.Printf("Backfilled %d of %d blocks between %d and %d, %d gaps remain\n", status.BlocksDone, status.BlocksTotal, first, last, status.GapsRemaining)
+	if status.Error != "" {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sameHeightRanges(got []HeightRangeV1, want []HeightRangeV1) bool {
+	if len(got) == 0 && len(want) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(got, want)
+}
+
+func TestSubtractHeightRange(t *testing.T) {
+	tests := []struct {
+		name string
+		gaps []HeightRangeV1
+		done HeightRangeV1
+		want []HeightRangeV1
+	}{
+		{"gap fully inside the compacted range", []HeightRangeV1{{10, 20}}, HeightRangeV1{5, 25}, nil},
+		{"gap equal to the compacted range", []HeightRangeV1{{10, 20}}, HeightRangeV1{10, 20}, nil},
+		{"compacted range inside the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{12, 15}, []HeightRangeV1{{10, 11}, {16, 20}}},
+		{"overlapping the start of the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{5, 12}, []HeightRangeV1{{13, 20}}},
+		{"overlapping the end of the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{18, 30}, []HeightRangeV1{{10, 17}}},
+		{"first height of the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{10, 10}, []HeightRangeV1{{11, 20}}},
+		{"last height of the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{20, 20}, []HeightRangeV1{{10, 19}}},
+		{"adjacent below the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{5, 9}, []HeightRangeV1{{10, 20}}},
+		{"adjacent above the gap", []HeightRangeV1{{10, 20}}, HeightRangeV1{21, 25}, []HeightRangeV1{{10, 20}}},
+		{"across several gaps", []HeightRangeV1{{0, 4}, {10, 20}, {30, 30}}, HeightRangeV1{3, 30}, []HeightRangeV1{{0, 2}}},
+		{"between gaps", []HeightRangeV1{{0, 4}, {10, 20}}, HeightRangeV1{5, 9}, []HeightRangeV1{{0, 4}, {10, 20}}},
+		{"no gaps", nil, HeightRangeV1{0, 100}, nil},
+	}
+	for _, test := range tests {
+		got := subtractHeightRange(test.gaps, test.done)
+		if !sameHeightRanges(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Walk stored heights the way findHeightGaps does
+func walkHeightGaps(from int, to int, heights []int) []HeightRangeV1 {
+	var gaps []HeightRangeV1
+	next := from
+	for _, height := range heights {
+		gaps, next = addHeightGap(gaps, next, height)
+	}
+	gaps, _ = addHeightGap(gaps, next, to+1)
+	return gaps
+}
+
+func TestAddHeightGap(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    int
+		to      int
+		heights []int
+		want    []HeightRangeV1
+	}{
+		{"nothing stored", 5, 20, nil, []HeightRangeV1{{5, 20}}},
+		{"everything stored", 5, 7, []int{5, 6, 7}, nil},
+		{"gaps in the middle and at the end", 5, 20, []int{5, 6, 9}, []HeightRangeV1{{7, 8}, {10, 20}}},
+		{"gap at the start", 5, 7, []int{7}, []HeightRangeV1{{5, 6}}},
+		{"single missing height", 5, 7, []int{5, 7}, []HeightRangeV1{{6, 6}}},
+		{"from genesis", 0, 3, []int{1, 2, 3}, []HeightRangeV1{{0, 0}}},
+		{"single height range", 4, 4, nil, []HeightRangeV1{{4, 4}}},
+	}
+	for _, test := range tests {
+		got := walkHeightGaps(test.from, test.to, test.heights)
+		if !sameHeightRanges(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+		if blocks, missing := countGapBlocks(got), test.to-test.from+1-len(test.heights); blocks != missing {
+			t.Errorf("%s: %d gap blocks, want %d", test.name, blocks, missing)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Used when TargetBlockTime is not set in the config
+const defaultTargetBlockTime = 15
+
+// Upper bounds (in seconds) of the interval histogram buckets, the last bucket is open ended
+var intervalHistogramBounds = []int{15, 30, 60, 120, 300, 600, 1800}
+
+// Number of longest gaps between blocks to report for the window
+const numLongestGaps = 10
+
+type blockInterval struct {
+	Height    int // Height of the block that ended the interval
+	StartTime int
+	EndTime   int
+	Seconds   int
+}
+
+type IntervalStat struct {
+	NumBlocks           int
+	AvgInterval         float64
+	MedianInterval      float64
+	LongestInterval     int
+	BlocksPerHour       float64
+	TargetBlocksPerHour float64
+}
+
+type IntervalHistogramBucket struct {
+	MinSeconds int
+	MaxSeconds int // 0 for the last, open ended, bucket
+	Count      int
+}
+
+type BlockGap struct {
+	StartHeight int
+	EndHeight   int
+	StartTime   int
+	EndTime     int
+	Seconds     int
+}
+
+type blockTimeRPC struct {
+	NumDays  int    `form:"numDays"`
+	TimeZone string `form:"timeZone"`
+}
+
+func getTargetBlockTime() int {
+	if c.TargetBlockTime > 0 {
+		return c.TargetBlockTime
+	}
+	return defaultTargetBlockTime
+}
+
+// Get the intervals between consecutive blocks for every block whose time is in the epoch range.
+// Blocks whose previous height is not cached are skipped since we can't know their interval.
+func getBlockIntervalsInEpochRange(startEpoch int64, endEpoch int64) []blockInterval {
+	var intervals []blockInterval
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	lowest, highest := findBlocksForEpochRange(startEpoch, endEpoch)
+	for i := lowest; i <= highest; i++ {
+		block, ok := blockMap[i]
+		if !ok || int64(block.Time) < startEpoch || int64(block.Time) >= endEpoch {
+			continue
+		}
+		prevBlock, ok := blockMap[i-1]
+		if !ok {
+			continue
+		}
+		intervals = append(intervals, blockInterval{
+			Height:    i,
+			StartTime: prevBlock.Time,
+			EndTime:   block.Time,
+			Seconds:   block.Time - prevBlock.Time,
+		})
+	}
+
+	return intervals
+}
+
+// Summarize intervals for a bucket of time. elapsedSeconds is how much of the bucket has passed,
+// which is less than the bucket length for the current hour or day.
+func summarizeIntervals(intervals []blockInterval, elapsedSeconds int64) IntervalStat {
+	var stat IntervalStat
+	stat.TargetBlocksPerHour = 3600.0 / float64(getTargetBlockTime())
+	stat.NumBlocks = len(intervals)
+	if elapsedSeconds > 0 {
+		stat.BlocksPerHour = float64(stat.NumBlocks) * 3600.0 / float64(elapsedSeconds)
+	}
+	if stat.NumBlocks == 0 {
+		return stat
+	}
+
+	seconds := make([]int, 0, len(intervals))
+	total := 0
+	for _, interval := range intervals {
+		seconds = append(seconds, interval.Seconds)
+		total += interval.Seconds
+		if interval.Seconds > stat.LongestInterval {
+			stat.LongestInterval = interval.Seconds
+		}
+	}
+	sort.Ints(seconds)
+
+	stat.AvgInterval = float64(total) / float64(len(seconds))
+	middle := len(seconds) / 2
+	if len(seconds)%2 == 0 {
+		stat.MedianInterval = float64(seconds[middle-1]+seconds[middle]) / 2.0
+	} else {
+		stat.MedianInterval = float64(seconds[middle])
+	}
+
+	return stat
+}
+
+func getIntervalHistogram(intervals []blockInterval) []IntervalHistogramBucket {
+	buckets := make([]IntervalHistogramBucket, len(intervalHistogramBounds)+1)
+	lowerBound := 0
+	for i, upperBound := range intervalHistogramBounds {
+		buckets[i].MinSeconds = lowerBound
+		buckets[i].MaxSeconds = upperBound
+		lowerBound = upperBound
+	}
+	buckets[len(buckets)-1].MinSeconds = lowerBound
+
+	for _, interval := range intervals {
+		// Block times are not guaranteed to be increasing, negative intervals land in the first bucket
+		bucket := sort.SearchInts(intervalHistogramBounds, interval.Seconds+1)
+		buckets[bucket].Count++
+	}
+
+	return buckets
+}
+
+func getLongestGaps(intervals []blockInterval, count int) []BlockGap {
+	sorted := make([]blockInterval, len(intervals))
+	copy(sorted, intervals)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Seconds > sorted[j].Seconds
+	})
+	if len(sorted) > count {
+		sorted = sorted[:count]
+	}
+
+	gaps := make([]BlockGap, 0, len(sorted))
+	for _, interval := range sorted {
+		gaps = append(gaps, BlockGap{
+			StartHeight: interval.Height - 1,
+			EndHeight:   interval.Height,
+			StartTime:   interval.StartTime,
+			EndTime:     interval.EndTime,
+			Seconds:     interval.Seconds,
+		})
+	}
+
+	return gaps
+}
+
+// Elapsed part of an epoch range, capped at the current time
+func getElapsedSeconds(startEpoch int64, endEpoch int64) int64 {
+	now := time.Now().Unix()
+	if now < endEpoch {
+		endEpoch = now
+	}
+	return endEpoch - startEpoch
+}
+
+// Accept json request like:
+// {"NumDays": 7, "TimeZone": "America/Los_Angeles"}
+// or the same as GET query parameters: /getblocktimestats?numDays=7&timeZone=America/Los_Angeles
+func getBlockTimeStatsRPC(c *gin.Context) {
+	var jsonBody blockTimeRPC
+
+	if err := bindStatsRequest(c, &jsonBody); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	thisResponse, ok := getBlockTimeStats(c, jsonBody)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, thisResponse)
+}
+
+type HourIntervalStat struct {
+	Hour int
+	IntervalStat
+}
+
+type DayIntervalStat struct {
+	Day string
+	IntervalStat
+}
+
+type BlockTimeStats struct {
+	HourlyStats     []HourIntervalStat
+	DailyStats      []DayIntervalStat
+	WindowStats     IntervalStat
+	Histogram       []IntervalHistogramBucket
+	LongestGaps     []BlockGap
+	TargetBlockTime int
+}
+
+// Validate a block time stats request and build the stats for it. On a bad request the error
+// response has already been sent and ok is false.
+func getBlockTimeStats(c *gin.Context, jsonBody blockTimeRPC) (thisResponse BlockTimeStats, ok bool) {
+
+	loc, err := parseTimeZone(jsonBody.TimeZone)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidTimeZone, err.Error())
+		return thisResponse, false
+	}
+
+	numDays, err := parseNumDays(jsonBody.NumDays)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidRange, err.Error())
+		return thisResponse, false
+	}
+
+	var hourStats []HourIntervalStat
+
+	hoursToday := getCurrentHour(loc)
+	for i := 0; i <= hoursToday; i++ {
+		startEpoch := getHourStart(i-hoursToday, loc)
+		endEpoch := startEpoch + 3600
+		intervals := getBlockIntervalsInEpochRange(startEpoch, endEpoch)
+
+		hourStats = append(hourStats, HourIntervalStat{
+			Hour:         i,
+			IntervalStat: summarizeIntervals(intervals, getElapsedSeconds(startEpoch, endEpoch)),
+		})
+	}
+
+	var dayStats []DayIntervalStat
+
+	windowStart := getDayStart(-numDays, loc)
+	for i := 0; i <= numDays; i++ {
+		curDay := i - numDays
+		startEpoch := getDayStart(curDay, loc)
+		endEpoch := getDayStart(curDay+1, loc)
+		intervals := getBlockIntervalsInEpochRange(startEpoch, endEpoch)
+
+		thisDay := DayIntervalStat{
+			IntervalStat: summarizeIntervals(intervals, getElapsedSeconds(startEpoch, endEpoch)),
+		}
+		if i < numDays {
+			thisDay.Day = time.Unix(startEpoch, 0).In(loc).Format("2006-01-02")
+		} else {
+			thisDay.Day = "Today"
+		}
+		dayStats = append(dayStats, thisDay)
+	}
+
+	windowEnd := time.Now().Unix() + 1
+	windowIntervals := getBlockIntervalsInEpochRange(windowStart, windowEnd)
+
+	thisResponse.HourlyStats = hourStats
+	thisResponse.DailyStats = dayStats
+	thisResponse.WindowStats = summarizeIntervals(windowIntervals, windowEnd-windowStart)
+	thisResponse.Histogram = getIntervalHistogram(windowIntervals)
+	thisResponse.LongestGaps = getLongestGaps(windowIntervals, numLongestGaps)
+	thisResponse.TargetBlockTime = getTargetBlockTime()
+
+	return thisResponse, true
+}
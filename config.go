@@ -19,6 +19,77 @@ type conf struct {
 	ServiceDBPass string `yaml:"ServiceDBPass"`
 	ServiceDBName string `yaml:"ServiceDBName"`
 	ServicePort   string `yaml:"ServicePort"`
+	RequireAPIKey bool   `yaml:"RequireAPIKey"`
+	LogLevel      string `yaml:"LogLevel"`
+	LogFormat     string `yaml:"LogFormat"`
+
+	AdminWithoutAPIKey bool `yaml:"AdminWithoutAPIKey"`
+
+	RateLimitPerIP       int   `yaml:"RateLimitPerIP"`
+	RateLimitPerIPBurst  int   `yaml:"RateLimitPerIPBurst"`
+	RateLimitPerKey      int   `yaml:"RateLimitPerKey"`
+	RateLimitPerKeyBurst int   `yaml:"RateLimitPerKeyBurst"`
+	MaxAddresses         int   `yaml:"MaxAddresses"`
+	MaxRequestBytes      int64 `yaml:"MaxRequestBytes"`
+
+	TrustedProxies []string `yaml:"TrustedProxies"`
+
+	ReadyMaxSyncLag int `yaml:"ReadyMaxSyncLag"`
+
+	TargetBlockTime int `yaml:"TargetBlockTime"`
+
+	BlockHistoryDepth   int `yaml:"BlockHistoryDepth"`
+	MemoryRetentionDays int `yaml:"MemoryRetentionDays"`
+	DBRetentionDays     int `yaml:"DBRetentionDays"`
+
+	PriceURL           string `yaml:"PriceURL"`
+	PriceFiatCurrency  string `yaml:"PriceFiatCurrency"`
+	PriceUpdateMinutes int    `yaml:"PriceUpdateMinutes"`
+
+	Pools         map[string]poolConf `yaml:"Pools"`
+	PoolAddresses []string            `yaml:"PoolAddresses"`
+
+	Notifiers  map[string]notifierConf `yaml:"Notifiers"`
+	AlertRules []alertRuleConf         `yaml:"AlertRules"`
+	NodeAlerts nodeAlertConf           `yaml:"NodeAlerts"`
+}
+
+type poolConf struct {
+	BaseURL  string `yaml:"BaseURL"`
+	Disabled bool   `yaml:"Disabled"`
+}
+
+type notifierConf struct {
+	Type     string   `yaml:"Type"` // webhook, smtp or chat
+	URL      string   `yaml:"URL"`
+	Secret   string   `yaml:"Secret"`
+	ChatID   string   `yaml:"ChatID"`
+	SMTPHost string   `yaml:"SMTPHost"`
+	SMTPPort int      `yaml:"SMTPPort"`
+	SMTPUser string   `yaml:"SMTPUser"`
+	SMTPPass string   `yaml:"SMTPPass"`
+	From     string   `yaml:"From"`
+	To       []string `yaml:"To"`
+}
+
+type alertRuleConf struct {
+	Name          string   `yaml:"Name"`
+	Group         string   `yaml:"Group"`
+	Type          string   `yaml:"Type"` // no_block, win_percent or luck
+	Hours         int      `yaml:"Hours"`
+	Threshold     float64  `yaml:"Threshold"`
+	BaselineHours int      `yaml:"BaselineHours"`
+	Confidence    float64  `yaml:"Confidence"`
+	Notifiers     []string `yaml:"Notifiers"`
+}
+
+type nodeAlertConf struct {
+	Disabled          bool     `yaml:"Disabled"`
+	NodeDownMinutes   int      `yaml:"NodeDownMinutes"`
+	MaxSyncLag        int      `yaml:"MaxSyncLag"`
+	NoNewBlockMinutes int      `yaml:"NoNewBlockMinutes"`
+	StaleTipMinutes   int      `yaml:"StaleTipMinutes"`
+	Notifiers         []string `yaml:"Notifiers"`
 }
 
 func (c *conf) getConf() *conf {
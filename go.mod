@@ -2,6 +2,8 @@ module dmo-statservice
 
 go 1.17
 
+require github.com/gorilla/websocket v1.5.0
+
 require (
 	github.com/gin-contrib/sse v0.1.0 // indirect
 	github.com/gin-gonic/gin v1.7.7 // indirect
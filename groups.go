@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GroupMember struct {
+	Address string
+	Label   string
+}
+
+type AddrGroup struct {
+	Name    string
+	Members []GroupMember
+}
+
+// Key is the group name
+var addrGroups = make(map[string]AddrGroup)
+
+var groupNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func loadAddrGroupsToMemory() {
+	loadedGroups := make(map[string]AddrGroup)
+
+	results, err := db.Query("select name from address_groups")
+	if err != nil {
+		panic(err.Error())
+	}
+	defer results.Close()
+	for results.Next() {
+		var name string
+		if err = results.Scan(&name); err != nil {
+			panic(err.Error())
+		}
+		loadedGroups[name] = AddrGroup{Name: name, Members: []GroupMember{}}
+	}
+
+	members, err := db.Query("select group_name, address, label from address_group_members order by group_name, address")
+	if err != nil {
+		panic(err.Error())
+	}
+	defer members.Close()
+	for members.Next() {
+		var name string
+		var member GroupMember
+		if err = members.Scan(&name, &member.Address, &member.Label); err != nil {
+			panic(err.Error())
+		}
+		if group, ok := loadedGroups[name]; ok {
+			group.Members = append(group.Members, member)
+			loadedGroups[name] = group
+		}
+	}
+
+	mutex.Lock()
+	addrGroups = loadedGroups
+	mutex.Unlock()
+}
+
+func getAddrGroup(name string) (AddrGroup, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	group, ok := addrGroups[name]
+	return group, ok
+}
+
+// Get the comma separated addresses of a group, in the same form as the Addresses request field
+func getAddrGroupAddresses(name string) (string, error) {
+	group, ok := getAddrGroup(name)
+	if !ok {
+		return "", fmt.Errorf("unknown group %s", name)
+	}
+	var addrs []string
+	for _, member := range group.Members {
+		addrs = append(addrs, member.Address)
+	}
+	return strings.Join(addrs, ","), nil
+}
+
+// Create or replace a group and its members in the DB and memory
+func saveAddrGroup(group AddrGroup) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("INSERT IGNORE INTO address_groups (name) VALUES (?)", group.Name); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM address_group_members WHERE group_name = ?", group.Name); err != nil {
+		return err
+	}
+	for _, member := range group.Members {
+		_, err = tx.Exec("INSERT INTO address_group_members (group_name, address, label) VALUES (?, ?, ?)",
+			group.Name, member.Address, member.Label)
+		if err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	addrGroups[group.Name] = group
+	mutex.Unlock()
+	return nil
+}
+
+// Delete a group along with its webhooks
+func deleteAddrGroup(name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec("DELETE FROM address_group_members WHERE group_name = ?", name); err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM address_groups WHERE name = ?", name); err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM group_webhooks WHERE group_name = ?)", name)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM group_webhooks WHERE group_name = ?", name); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	delete(addrGroups, name)
+	delete(groupWebhooks, name)
+	mutex.Unlock()
+	return nil
+}
+
+func listAddrGroupsRPC(c *gin.Context) {
+	c.JSON(http.StatusOK, listAddrGroups())
+}
+
+// All groups sorted by name
+func listAddrGroups() []AddrGroup {
+	mutex.Lock()
+	groups := make([]AddrGroup, 0, len(addrGroups))
+	for _, group := range addrGroups {
+		groups = append(groups, group)
+	}
+	mutex.Unlock()
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+	return groups
+}
+
+func getAddrGroupRPC(c *gin.Context) {
+	group, ok := getAddrGroup(c.Param("name"))
+	if !ok {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// Accept json request like:
+// {"Members": [{"Address": "dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvm", "Label": "rig 1"}]}
+func putAddrGroupRPC(c *gin.Context) {
+	var jsonBody struct {
+		Members []GroupMember
+	}
+	if err := c.ShouldBindJSON(&jsonBody); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	group, ok := putAddrGroup(c, c.Param("name"), jsonBody.Members)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// Validate and save a group from a request. On a bad request the error response has already
+// been sent and ok is false.
+func putAddrGroup(c *gin.Context, name string, members []GroupMember) (AddrGroup, bool) {
+	group := AddrGroup{Name: name, Members: []GroupMember{}}
+	if !groupNameRegexp.MatchString(group.Name) {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidName, "group names are 1 to 64 letters, digits, - or _")
+		return group, false
+	}
+	seen := make(map[string]bool)
+	for _, member := range members {
+		member.Address = strings.TrimSpace(member.Address)
+		if err := validateDMOAddress(member.Address); err != nil {
+			abortWithError(c, http.StatusBadRequest, errCodeInvalidAddress, fmt.Sprintf("invalid address %q: %s", member.Address, err.Error()))
+			return group, false
+		}
+		member.Address = normalizeDMOAddress(member.Address)
+		if len(member.Label) > 128 {
+			abortWithError(c, http.StatusBadRequest, errCodeBadRequest, "member labels must be at most 128 characters")
+			return group, false
+		}
+		if seen[member.Address] {
+			continue
+		}
+		seen[member.Address] = true
+		group.Members = append(group.Members, member)
+	}
+	if len(group.Members) > getMaxAddresses() {
+		abortWithError(c, http.StatusBadRequest, errCodeTooManyAddresses, fmt.Sprintf("groups can have at most %d addresses", getMaxAddresses()))
+		return group, false
+	}
+	sort.Slice(group.Members, func(i, j int) bool { return group.Members[i].Address < group.Members[j].Address })
+
+	if err := saveAddrGroup(group); err != nil {
+		requestLog(c).error("unable to save group", "group", group.Name, "error", err)
+		abortWithError(c, http.StatusInternalServerError, errCodeInternal, "unable to save group")
+		return group, false
+	}
+
+	return group, true
+}
+
+func deleteAddrGroupRPC(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := getAddrGroup(name); !ok {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+		return
+	}
+
+	if err := deleteAddrGroup(name); err != nil {
+		requestLog(c).error("unable to delete group", "group", name, "error", err)
+		abortWithError(c, http.StatusInternalServerError, errCodeInternal, "unable to delete group")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string        `json:"status"` // ok or fail
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Set once the blocks, groups and pool data have been loaded at startup
+var initialLoadDone int32
+
+func markInitialLoadDone() {
+	atomic.StoreInt32(&initialLoadDone, 1)
+}
+
+func isInitialLoadDone() bool {
+	return atomic.LoadInt32(&initialLoadDone) == 1
+}
+
+func getReadyMaxSyncLag() int {
+	if c.ReadyMaxSyncLag <= 0 {
+		return 20
+	}
+	return c.ReadyMaxSyncLag
+}
+
+// Middleware that answers 503 until the initial load is done, so requests never see half loaded data
+func waitForInitialLoad(c *gin.Context) {
+	if !isInitialLoadDone() {
+		c.Header("Retry-After", "30")
+		abortWithError(c, http.StatusServiceUnavailable, errCodeUnavailable, "service is still loading")
+		return
+	}
+	c.Next()
+}
+
+func checkDB() HealthCheck {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		return HealthCheck{Name: "db", OK: false, Detail: err.Error()}
+	}
+	return HealthCheck{Name: "db", OK: true}
+}
+
+func respondHealth(c *gin.Context, checks []HealthCheck) {
+	response := HealthResponse{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, check := range checks {
+		if !check.OK {
+			response.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(status, response)
+}
+
+// Liveness, the process is up and can reach its DB
+func healthzRPC(c *gin.Context) {
+	respondHealth(c, []HealthCheck{checkDB()})
+}
+
+// Readiness, the initial load is done, the node is reachable and syncing is caught up
+func readyzRPC(c *gin.Context) {
+	checks := []HealthCheck{checkDB()}
+
+	if isInitialLoadDone() {
+		checks = append(checks, HealthCheck{Name: "initial_load", OK: true})
+	} else {
+		checks = append(checks, HealthCheck{Name: "initial_load", OK: false, Detail: "still loading"})
+	}
+
+	health := getNodeHealth()
+	if health.Reachable {
+		checks = append(checks, HealthCheck{Name: "node", OK: true, Detail: fmt.Sprintf("height %d", health.NodeHeight)})
+	} else if health.LastError != "" {
+		checks = append(checks, HealthCheck{Name: "node", OK: false, Detail: health.LastError})
+	} else {
+		checks = append(checks, HealthCheck{Name: "node", OK: false, Detail: "not contacted yet"})
+	}
+
+	lag := health.NodeHeight - health.SyncedHeight
+	lagCheck := HealthCheck{Name: "sync_lag", OK: lag <= getReadyMaxSyncLag(), Detail: fmt.Sprintf("%d blocks behind the node", lag)}
+	if health.SyncedHeight == 0 {
+		lagCheck = HealthCheck{Name: "sync_lag", OK: false, Detail: "no sync with the node has finished"}
+	}
+	checks = append(checks, lagCheck)
+
+	respondHealth(c, checks)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Longest ranges a history request may cover, per interval
+const (
+	maxHistoryHours = 31 * 24
+	maxHistoryDays  = 3660
+)
+
+type historyRequestV1 struct {
+	Addresses string `json:"addresses" form:"addresses"`
+	Group     string `json:"group" form:"group"`
+	Start     int64  `json:"start" form:"start"`       // Unix time, defaults to 30 days before end
+	End       int64  `json:"end" form:"end"`           // Unix time, exclusive, defaults to now
+	Interval  string `json:"interval" form:"interval"` // hour or day, defaults to day
+	TimeZone  string `json:"time_zone" form:"time_zone"`
+}
+
+type HistoryPointV1 struct {
+	Start       int64              `json:"start"`
+	Blocks      int                `json:"blocks"`
+	Coins       float64            `json:"coins"` // Solo and pool coins together
+	SoloCoins   float64            `json:"solo_coins"`
+	PoolCoins   map[string]float64 `json:"pool_coins"` // Key is the pool provider name
+	ChainBlocks int                `json:"chain_blocks"`
+	ChainCoins  float64            `json:"chain_coins"`
+	WinPercent  float64            `json:"win_percent"` // Solo coins as a percent of all coins mined on chain
+	FiatValue   float64            `json:"fiat_value"`  // Coins valued at the stored price when they were mined
+	BTCValue    float64            `json:"btc_value"`
+}
+
+type HistoryV1 struct {
+	Interval     string           `json:"interval"`
+	TimeZone     string           `json:"time_zone"`
+	FiatCurrency string           `json:"fiat_currency"`
+	Points       []HistoryPointV1 `json:"points"`
+}
+
+// Mined blocks and coins per hour or day over any range, read from the DB so it reaches past the
+// memory retention. Raw blocks and the stats_hourly rollups of compacted blocks are combined, and
+// pool earnings are attributed from the stored balances and payouts the same way as for the stats
+// routes. Each UTC hour of blocks is counted in the bucket it starts in, which only matters for day
+// buckets in zones offset by a fraction of an hour. Coins are valued at the stored price in effect
+// at the start of their hour, pool earnings at the price when they were earned.
+func getHistoryV1RPC(c *gin.Context) {
+	var request historyRequestV1
+	if err := bindStatsRequest(c, &request); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	if request.Group != "" {
+		addresses, err := getAddrGroupAddresses(request.Group)
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+			return
+		}
+		request.Addresses = addresses
+	}
+	addrs, err := parseAddresses(request.Addresses)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidAddress, err.Error())
+		return
+	}
+	if len(addrs) == 0 {
+		abortWithError(c, http.StatusBadRequest, errCodeMissingAddresses, "addresses or group is required")
+		return
+	}
+	if len(addrs) > getMaxAddresses() {
+		abortWithError(c, http.StatusBadRequest, errCodeTooManyAddresses, fmt.Sprintf("at most %d addresses can be requested", getMaxAddresses()))
+		return
+	}
+	if !apiKeyAllows(c, request.Group, addrs) {
+		abortWithError(c, http.StatusForbidden, errCodeForbidden, "api key is not allowed to query these addresses")
+		return
+	}
+
+	loc, err := parseTimeZone(request.TimeZone)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidTimeZone, err.Error())
+		return
+	}
+
+	buckets, err := getHistoryBuckets(&request, loc)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidRange, err.Error())
+		return
+	}
+
+	points, err := getHistoryPoints(buckets, addrs)
+	if err != nil {
+		requestLog(c).error("unable to read history", "error", err)
+		abortWithError(c, http.StatusInternalServerError, errCodeInternal, "unable to read history")
+		return
+	}
+
+	c.JSON(http.StatusOK, HistoryV1{Interval: request.Interval, TimeZone: loc.String(), FiatCurrency: getFiatCurrency(), Points: points})
+}
+
+// Check the range and interval and return the start of every bucket, plus the end of the last one
+func getHistoryBuckets(request *historyRequestV1, loc *time.Location) ([]int64, error) {
+	if request.Interval == "" {
+		request.Interval = "day"
+	}
+	if request.End == 0 {
+		request.End = time.Now().Unix()
+	}
+	if request.Start == 0 {
+		request.Start = request.End - 30*24*60*60
+	}
+	if request.Start < 0 || request.Start >= request.End {
+		return nil, fmt.Errorf("start must be before end")
+	}
+
+	var buckets []int64
+	switch request.Interval {
+	case "hour":
+		if request.End-request.Start > maxHistoryHours*3600 {
+			return nil, fmt.Errorf("hourly history covers at most %d days", maxHistoryHours/24)
+		}
+		for bucket := request.Start - request.Start%3600; bucket < request.End; bucket += 3600 {
+			buckets = append(buckets, bucket)
+		}
+		buckets = append(buckets, buckets[len(buckets)-1]+3600)
+	case "day":
+		if request.End-request.Start > maxHistoryDays*24*60*60 {
+			return nil, fmt.Errorf("daily history covers at most %d days", maxHistoryDays)
+		}
+		startTime := time.Unix(request.Start, 0).In(loc)
+		day := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, loc)
+		for ; day.Unix() < request.End; day = day.AddDate(0, 0, 1) {
+			buckets = append(buckets, day.Unix())
+		}
+		buckets = append(buckets, day.Unix())
+	default:
+		return nil, fmt.Errorf("interval must be hour or day")
+	}
+	return buckets, nil
+}
+
+// Sum the hourly totals into the buckets, the last entry of buckets is the end of the range
+func getHistoryPoints(buckets []int64, addrs []string) ([]HistoryPointV1, error) {
+	start := buckets[0] - buckets[0]%3600
+	end := buckets[len(buckets)-1]
+	if end%3600 != 0 {
+		end += 3600 - end%3600
+	}
+
+	inAddrs := "miningaddr IN (?" + strings.Repeat(", ?", len(addrs)-1) + ")"
+	var args []interface{}
+	addArgs := func() {
+		for _, addr := range addrs {
+			args = append(args, addr)
+		}
+	}
+	addArgs()
+	addArgs()
+	args = append(args, start, end)
+	addArgs()
+	addArgs()
+	args = append(args, start, end)
+
+	historyPrices, err := loadPriceHistory(start, end)
+	if err != nil {
+		return nil, err
+	}
+	addValue := func(point *HistoryPointV1, epoch int64, coins float64) {
+		if thisPrice, ok := findPriceAtEpoch(historyPrices, epoch); ok {
+			point.FiatValue += coins * thisPrice.Fiat
+			point.BTCValue += coins * thisPrice.BTC
+		}
+	}
+
+	results, err := db.Query(`
+		SELECT hour, sum(blocks), sum(coins), sum(addr_blocks), sum(addr_coins) FROM (
+			SELECT hour_epoch AS hour, blocks, coins, IF(`+inAddrs+`, blocks, 0) AS addr_blocks, IF(`+inAddrs+`, coins, 0) AS addr_coins
+			FROM stats_hourly WHERE hour_epoch >= ? AND hour_epoch < ?
+			UNION ALL
+			SELECT epoch - epoch % 3600, 1, coalesce(coins, 0), IF(`+inAddrs+`, 1, 0), IF(`+inAddrs+`, coalesce(coins, 0), 0)
+			FROM stats WHERE epoch >= ? AND epoch < ?
+		) AS hours GROUP BY hour ORDER BY hour`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	points := make([]HistoryPointV1, len(buckets)-1)
+	for i := range points {
+		points[i].Start = buckets[i]
+		points[i].PoolCoins = make(map[string]float64)
+		for _, name := range getPoolProviderNames() {
+			points[i].PoolCoins[name] = 0.0
+		}
+	}
+	i := 0
+	for results.Next() {
+		var hour int64
+		var point HistoryPointV1
+		if err = results.Scan(&hour, &point.ChainBlocks, &point.ChainCoins, &point.Blocks, &point.Coins); err != nil {
+			return nil, err
+		}
+		for i+1 < len(points) && hour >= buckets[i+1] {
+			i++
+		}
+		points[i].Blocks += point.Blocks
+		points[i].SoloCoins += point.Coins
+		points[i].ChainBlocks += point.ChainBlocks
+		points[i].ChainCoins += point.ChainCoins
+		addValue(&points[i], hour, point.Coins)
+	}
+	if err = results.Err(); err != nil {
+		return nil, err
+	}
+
+	results.Close()
+
+	for _, name := range getPoolProviderNames() {
+		for _, addr := range addrs {
+			thisPoolInfo, err := loadPoolHistory(name, addr, buckets[0], buckets[len(buckets)-1])
+			if err != nil {
+				return nil, err
+			}
+			forEachPoolEarningInEpochRange(thisPoolInfo, buckets[0], buckets[len(buckets)-1], func(epoch int64, coins float64) {
+				i := sort.Search(len(points), func(i int) bool { return buckets[i+1] > epoch })
+				if i < len(points) {
+					points[i].PoolCoins[name] += coins
+					addValue(&points[i], epoch, coins)
+				}
+			})
+		}
+	}
+
+	for i := range points {
+		points[i].Coins = points[i].SoloCoins
+		for _, coins := range points[i].PoolCoins {
+			points[i].Coins += coins
+		}
+		if points[i].SoloCoins > 0.1 && points[i].ChainCoins > 0.1 {
+			points[i].WinPercent = points[i].SoloCoins * 100.0 / points[i].ChainCoins
+		}
+	}
+	return points, nil
+}
+
+// Read the pool balances and payouts for an address that forEachPoolEarningInEpochRange needs for
+// earnings between start and end: the snapshots from the last one before start to the first one
+// at or after end, and the payouts between them
+func loadPoolHistory(name string, addr string, start int64, end int64) (poolInfoForAddr, error) {
+	thisPoolInfo := poolInfoForAddr{payouts: make(map[int64]float64)}
+
+	var before, after sql.NullInt64
+	err := db.QueryRow("SELECT max(epoch) FROM pool_balances WHERE provider = ? AND address = ? AND epoch < ?", name, addr, start).Scan(&before)
+	if err != nil {
+		return thisPoolInfo, err
+	}
+	err = db.QueryRow("SELECT min(epoch) FROM pool_balances WHERE provider = ? AND address = ? AND epoch >= ?", name, addr, end).Scan(&after)
+	if err != nil {
+		return thisPoolInfo, err
+	}
+	from := start
+	if before.Valid {
+		from = before.Int64
+	}
+	to := end + poolPayoutShiftSeconds
+	if after.Valid && after.Int64 > to {
+		to = after.Int64
+	}
+
+	snapshots, err := db.Query("SELECT epoch, unpaid FROM pool_balances WHERE provider = ? AND address = ? AND epoch >= ? AND epoch <= ? ORDER BY epoch",
+		name, addr, from, to)
+	if err != nil {
+		return thisPoolInfo, err
+	}
+	defer snapshots.Close()
+	for snapshots.Next() {
+		var snapshot poolBalanceSnapshot
+		if err = snapshots.Scan(&snapshot.Epoch, &snapshot.Unpaid); err != nil {
+			return thisPoolInfo, err
+		}
+		thisPoolInfo.snapshots = append(thisPoolInfo.snapshots, snapshot)
+	}
+	if err = snapshots.Err(); err != nil {
+		return thisPoolInfo, err
+	}
+
+	payouts, err := db.Query("SELECT created_at, coins FROM pool_payouts WHERE provider = ? AND address = ? AND created_at >= ? AND created_at <= ?",
+		name, addr, from, to)
+	if err != nil {
+		return thisPoolInfo, err
+	}
+	defer payouts.Close()
+	for payouts.Next() {
+		var createdAt int64
+		var coins float64
+		if err = payouts.Scan(&createdAt, &coins); err != nil {
+			return thisPoolInfo, err
+		}
+		thisPoolInfo.payouts[createdAt] = coins
+	}
+	return thisPoolInfo, payouts.Err()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetHistoryBuckets(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utcDay := func(year int, month time.Month, day int) int64 {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	newYorkDay := func(year int, month time.Month, day int) int64 {
+		return time.Date(year, month, day, 0, 0, 0, 0, newYork).Unix()
+	}
+
+	tests := []struct {
+		name     string
+		request  historyRequestV1
+		loc      *time.Location
+		want     []int64
+		wantsErr bool
+	}{
+		{
+			name:    "hours, start rounded down to the hour",
+			request: historyRequestV1{Interval: "hour", Start: 10*3600 + 100, End: 12 * 3600},
+			want:    []int64{10 * 3600, 11 * 3600, 12 * 3600},
+		},
+		{
+			name:    "hours, end inside the last hour",
+			request: historyRequestV1{Interval: "hour", Start: 10 * 3600, End: 10*3600 + 1},
+			want:    []int64{10 * 3600, 11 * 3600},
+		},
+		{
+			name:    "days in UTC",
+			request: historyRequestV1{Interval: "day", Start: utcDay(2026, 1, 1) + 12*3600, End: utcDay(2026, 1, 3)},
+			want:    []int64{utcDay(2026, 1, 1), utcDay(2026, 1, 2), utcDay(2026, 1, 3)},
+		},
+		{
+			name:    "23 hour day when DST starts",
+			request: historyRequestV1{Interval: "day", Start: newYorkDay(2026, 3, 8), End: newYorkDay(2026, 3, 9)},
+			loc:     newYork,
+			want:    []int64{newYorkDay(2026, 3, 8), newYorkDay(2026, 3, 8) + 23*3600},
+		},
+		{
+			name:    "25 hour day when DST ends",
+			request: historyRequestV1{Interval: "day", Start: newYorkDay(2026, 11, 1), End: newYorkDay(2026, 11, 2)},
+			loc:     newYork,
+			want:    []int64{newYorkDay(2026, 11, 1), newYorkDay(2026, 11, 1) + 25*3600},
+		},
+		{
+			name:    "day starts in the request's zone",
+			request: historyRequestV1{Interval: "day", Start: utcDay(2026, 1, 2) + 3600, End: utcDay(2026, 1, 2) + 2*3600},
+			loc:     newYork,
+			want:    []int64{newYorkDay(2026, 1, 1), newYorkDay(2026, 1, 2)},
+		},
+		{
+			name:     "start equal to end",
+			request:  historyRequestV1{Interval: "day", Start: 1000, End: 1000},
+			wantsErr: true,
+		},
+		{
+			name:     "start after end",
+			request:  historyRequestV1{Interval: "hour", Start: 2000, End: 1000},
+			wantsErr: true,
+		},
+		{
+			name:     "negative start",
+			request:  historyRequestV1{Interval: "hour", Start: -1, End: 1000},
+			wantsErr: true,
+		},
+		{
+			name:    "longest hourly range",
+			request: historyRequestV1{Interval: "hour", Start: 3600, End: 3600 + maxHistoryHours*3600},
+		},
+		{
+			name:     "hourly range too long",
+			request:  historyRequestV1{Interval: "hour", Start: 3600, End: 3600 + maxHistoryHours*3600 + 1},
+			wantsErr: true,
+		},
+		{
+			name:     "daily range too long",
+			request:  historyRequestV1{Interval: "day", Start: 3600, End: 3600 + maxHistoryDays*24*3600 + 1},
+			wantsErr: true,
+		},
+		{
+			name:     "unknown interval",
+			request:  historyRequestV1{Interval: "week", Start: 1000, End: 2000},
+			wantsErr: true,
+		},
+	}
+	for _, test := range tests {
+		loc := test.loc
+		if loc == nil {
+			loc = time.UTC
+		}
+		got, err := getHistoryBuckets(&test.request, loc)
+		if test.wantsErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if test.want != nil && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+		if got[0] > test.request.Start || got[len(got)-1] < test.request.End {
+			t.Errorf("%s: buckets %d to %d don't cover %d to %d", test.name, got[0], got[len(got)-1], test.request.Start, test.request.End)
+		}
+	}
+}
+
+func TestGetHistoryBucketsDefaults(t *testing.T) {
+	request := historyRequestV1{End: 100 * 24 * 3600}
+	buckets, err := getHistoryBuckets(&request, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Interval != "day" || request.Start != 70*24*3600 {
+		t.Errorf("got interval %q and start %d, want day and %d", request.Interval, request.Start, 70*24*3600)
+	}
+	if len(buckets) != 31 {
+		t.Errorf("got %d bucket edges, want 31", len(buckets))
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = map[logLevel]string{
+	levelDebug: "debug",
+	levelInfo:  "info",
+	levelWarn:  "warn",
+	levelError: "error",
+}
+
+// Key for the request scoped logger in the gin context
+const loggerContextKey = "logger"
+
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Leveled logger writing one JSON object or logfmt line per entry. Fields are key value pairs,
+// with() returns a logger that adds its fields to every entry.
+type leveledLogger struct {
+	out    *logOutput
+	fields []interface{}
+}
+
+type logOutput struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	level  logLevel
+	json   bool
+}
+
+// Usable before initLogger so startup code can always log
+var logger = &leveledLogger{out: &logOutput{writer: os.Stderr, level: levelInfo}}
+
+// Set the level and format from the config
+func initLogger() {
+	level := levelInfo
+	found := c.LogLevel == ""
+	for thisLevel, name := range logLevelNames {
+		if strings.EqualFold(c.LogLevel, name) {
+			level = thisLevel
+			found = true
+		}
+	}
+
+	logger.out.mutex.Lock()
+	logger.out.level = level
+	logger.out.json = strings.EqualFold(c.LogFormat, "json")
+	logger.out.mutex.Unlock()
+
+	if !found {
+		logger.warn("unknown log level, using info", "log_level", c.LogLevel)
+	}
+}
+
+func (l *leveledLogger) with(fields ...interface{}) *leveledLogger {
+	combined := make([]interface{}, 0, len(l.fields)+len(fields))
+	combined = append(combined, l.fields...)
+	combined = append(combined, fields...)
+	return &leveledLogger{out: l.out, fields: combined}
+}
+
+func (l *leveledLogger) debug(msg string, fields ...interface{}) {
+	l.log(levelDebug, msg, fields)
+}
+
+func (l *leveledLogger) info(msg string, fields ...interface{}) {
+	l.log(levelInfo, msg, fields)
+}
+
+func (l *leveledLogger) warn(msg string, fields ...interface{}) {
+	l.log(levelWarn, msg, fields)
+}
+
+func (l *leveledLogger) error(msg string, fields ...interface{}) {
+	l.log(levelError, msg, fields)
+}
+
+// Log at error level and exit, for startup problems the service can't run with
+func (l *leveledLogger) fatal(msg string, fields ...interface{}) {
+	l.log(levelError, msg, fields)
+	os.Exit(1)
+}
+
+func (l *leveledLogger) log(level logLevel, msg string, fields []interface{}) {
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+	if level < l.out.level {
+		return
+	}
+
+	keys := []string{"time", "level", "msg"}
+	values := map[string]interface{}{
+		"time":  time.Now().UTC().Format(time.RFC3339Nano),
+		"level": logLevelNames[level],
+		"msg":   msg,
+	}
+	all := append(append([]interface{}{}, l.fields...), fields...)
+	for i := 0; i+1 < len(all); i += 2 {
+		key := fmt.Sprint(all[i])
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		value := all[i+1]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		values[key] = value
+	}
+
+	var line []byte
+	if l.out.json {
+		line = formatJSONLogLine(values)
+	} else {
+		line = formatLogfmtLine(keys, values)
+	}
+	l.out.writer.Write(line)
+}
+
+func formatJSONLogLine(values map[string]interface{}) []byte {
+	line, err := json.Marshal(values)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"level": "error", "msg": "unable to encode log entry", "error": err.Error()})
+	}
+	return append(line, '\n')
+}
+
+func formatLogfmtLine(keys []string, values map[string]interface{}) []byte {
+	// The time, level and msg keys stay first, the rest are sorted so lines are easy to scan
+	sort.Strings(keys[3:])
+	var line strings.Builder
+	for i, key := range keys {
+		if i > 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(key)
+		line.WriteByte('=')
+		line.WriteString(formatLogfmtValue(values[key]))
+	}
+	line.WriteByte('\n')
+	return []byte(line.String())
+}
+
+func formatLogfmtValue(value interface{}) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Duration:
+		text = v.String()
+	default:
+		text = fmt.Sprint(v)
+	}
+	if text == "" || strings.ContainsAny(text, " =\"\t\n") {
+		return strconv.Quote(text)
+	}
+	return text
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(id)
+}
+
+// Middleware giving every request an id, from X-Request-ID when the client sends a sensible one,
+// and a logger carrying it. Each request is logged once when it finishes. Client IPs and
+// requested addresses are left out.
+func requestLogger(c *gin.Context) {
+	start := time.Now()
+	requestID := c.GetHeader("X-Request-ID")
+	if !requestIDRegexp.MatchString(requestID) {
+		requestID = newRequestID()
+	}
+	c.Header("X-Request-ID", requestID)
+	c.Set(loggerContextKey, logger.with("request_id", requestID))
+
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	fields := []interface{}{
+		"method", c.Request.Method,
+		"route", route,
+		"status", c.Writer.Status(),
+		"duration_ms", float64(time.Since(start).Microseconds()) / 1000.0,
+	}
+	if errorMessage := c.Errors.ByType(gin.ErrorTypePrivate).String(); errorMessage != "" {
+		fields = append(fields, "error", errorMessage)
+	}
+	requestLog(c).info("request", fields...)
+}
+
+// The request scoped logger, or the global one outside of requestLogger
+func requestLog(c *gin.Context) *leveledLogger {
+	if value, ok := c.Get(loggerContextKey); ok {
+		if thisLogger, ok := value.(*leveledLogger); ok {
+			return thisLogger
+		}
+	}
+	return logger
+}
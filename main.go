@@ -2,16 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -33,99 +37,174 @@ type blockInformation struct {
 
 var blockMap = make(map[int]blockInformation)
 
-type pogoInfoForAddr struct {
-	lastUpdate   int64
-	coinsAtTimes map[int64]float64
-}
-
-// Key is a receiving addr
-var pogoCoins = make(map[string]pogoInfoForAddr)
-
 var db *sql.DB
 var dbErr error
 
 var currentHeight int
 var currentDBHeight int
-var lowestDBHeight int
-var blockHistoryDepth int
+var lowestDBHeight int // Lowest height in blockMap, older blocks may still be in the DB
 var globalNetHash float64
 
 func main() {
 	gin.SetMode(gin.ReleaseMode)
-	router := gin.Default()
+	router := gin.New()
 
 	c.getConf()
+	initLogger()
 	currentDBHeight = 0
 	lowestDBHeight = 5000000000
 	globalNetHash = 0.0
 
-	blockHistoryDepth = 100000
-
 	db, dbErr = sql.Open("mysql", c.ServiceDBUser+":"+c.ServiceDBPass+"@tcp("+c.ServiceDBIP+":"+c.ServiceDBPort+")/"+c.ServiceDBName)
 	// Truly a fatal error.
 	if dbErr != nil {
 		panic(dbErr.Error())
 	}
 	defer db.Close()
-	fmt.Printf("Connected to DB: %s\n", c.ServiceDBName)
+	logger.info("connected to DB", "db", c.ServiceDBName)
 
-	getDBHeight()
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		runAPIKeyCommand(os.Args[2:])
+		return
+	}
 
-	currentHeight, err := getCurrentHeight()
-	if err != nil {
-		fmt.Printf("Unable to connect to node, using DB cache only, height %d: Error %s", currentDBHeight, err)
-		currentHeight = currentDBHeight
-	}
-	fmt.Printf("Current block height from node: %d\n", currentHeight)
-
-	fmt.Printf("Initializing...\n")
-	fmt.Printf("Loading new blocks from DB...\n")
-	updateStats()
-	fmt.Printf("Lowest DB height is %d", lowestDBHeight)
-	fmt.Printf("Highest DB height is %d", currentDBHeight)
-	fmt.Printf("Done loading new blocks from DB!\n")
-	fmt.Printf("Caching DB to memory...\n")
-	loadDBStatsToMemory()
-	fmt.Printf("DB cache to memory complete!\n")
+	// Stop on SIGINT or SIGTERM, the sync finishes the block it is on first
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var background sync.WaitGroup
 
-	// Grab new block info from the node every minute
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		runBackfillCommand(ctx, os.Args[2:])
+		return
+	}
+	initBackfill(ctx, &background)
+
+	initRateLimiters()
+	// X-Forwarded-For is only believed from these, so clients can't pick their own IP to rate limit
+	if err := router.SetTrustedProxies(c.TrustedProxies); err != nil {
+		logger.fatal("invalid TrustedProxies in config", "error", err)
+	}
+	router.Use(gin.Recovery(), requestLogger)
+	router.GET("/healthz", healthzRPC)
+	router.GET("/readyz", readyzRPC)
+	router.Use(metricsMiddleware, limitRequestSize, ipRateLimit, apiKeyAuth, keyRateLimit)
+	router.GET("/metrics", requireMetricsAccess, metricsRPC)
+	// Only routes added after this wait for the initial load
+	router.Use(waitForInitialLoad)
+	router.GET("/getminingstats", getAddrMiningStatsRPC)
+	router.POST("/getminingstats", getAddrMiningStatsRPC)
+	router.GET("/getblocktimestats", getBlockTimeStatsRPC)
+	router.POST("/getblocktimestats", getBlockTimeStatsRPC)
+
+	groupRoutes := router.Group("/groups", requireAdmin)
+	groupRoutes.GET("", listAddrGroupsRPC)
+	groupRoutes.GET("/:name", getAddrGroupRPC)
+	groupRoutes.PUT("/:name", putAddrGroupRPC)
+	groupRoutes.DELETE("/:name", deleteAddrGroupRPC)
+	groupRoutes.GET("/:name/webhooks", listGroupWebhooksRPC)
+	groupRoutes.POST("/:name/webhooks", createGroupWebhookRPC)
+	groupRoutes.DELETE("/:name/webhooks/:id", deleteGroupWebhookRPC)
+
+	registerAPIV1Routes(router)
+	router.NoRoute(notFoundRPC)
+
+	// Serve health checks and metrics while the initial load runs
+	server := &http.Server{Addr: ":" + c.ServicePort, Handler: router}
+	server.RegisterOnShutdown(closeStreams)
 	go func() {
-		fmt.Printf("Service is RUNNING on port %s\n", c.ServicePort)
-		for {
-			time.Sleep(60 * time.Second)
-			updateStats()
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			logger.fatal("unable to start router", "error", err)
 		}
 	}()
 
-	router.GET("/getminingstats", getAddrMiningStatsRPC)
-	err = router.Run(":" + c.ServicePort)
+	// Fatal, we need our DB
+	if err := getDBHeight(); err != nil {
+		panic(err.Error())
+	}
+
+	currentHeight, err := getCurrentHeight()
 	if err != nil {
-		log.Fatalf("Unable to start router: %s", err)
+		currentHeight = getCachedDBHeight()
+		logger.warn("unable to connect to node, using DB cache only", "height", currentHeight, "error", err)
 	}
-}
+	logger.info("current block height from node", "height", currentHeight)
 
-func getDBHeight() {
-	type DBResult struct {
-		HeightID int `json:"height_id"`
+	logger.info("initializing")
+	loadAddrGroupsToMemory()
+	loadGroupWebhooksToMemory()
+	logger.info("loading new blocks from node")
+	if err = updateStats(ctx); err != nil {
+		logger.error("unable to sync with node", "error", err)
 	}
+	if ctx.Err() != nil {
+		shutdown(server, &background)
+		return
+	}
+	mutex.Lock()
+	logger.info("done loading new blocks", "lowest_height", lowestDBHeight, "highest_height", currentDBHeight)
+	mutex.Unlock()
+	logger.info("caching DB to memory")
+	loadDBStatsToMemory()
+	logger.info("DB cache to memory complete", "blocks", len(blockMap))
+	loadPricesToMemory()
+	runInBackground(ctx, &background, runWebhookSender)
 
-	results, err := db.Query("select height_id from stats order by height_id desc limit 0,1")
-	// Fatal, we need our DB
-	if err != nil {
-		panic(err.Error())
+	initPoolProviders()
+	loadPoolPayoutsToMemory()
+	loadPoolBalancesToMemory()
+	runInBackground(ctx, &background, runPoolPoller)
+	runInBackground(ctx, &background, runRetention)
+
+	initPriceProvider()
+	if prices != nil {
+		runInBackground(ctx, &background, runPriceUpdater)
 	}
 
-	for results.Next() {
-		var dbResult DBResult
-		err = results.Scan(&dbResult.HeightID)
-		if err != nil {
-			panic(err.Error())
+	initNotifiers()
+	initAlertRules()
+	loadAlertStatesToMemory()
+
+	markInitialLoadDone()
+	logger.info("service is running", "port", c.ServicePort)
+
+	// Grab new block info from the node every minute
+	for {
+		select {
+		case <-ctx.Done():
+			shutdown(server, &background)
+			return
+		case <-time.After(60 * time.Second):
+		}
+		if err := updateStats(ctx); err != nil {
+			logger.error("unable to sync with node", "error", err)
 		}
-		currentDBHeight = dbResult.HeightID
+		evaluateAlerts()
+		evaluateNodeHealth()
+	}
+}
+
+func getDBHeight() error {
+	var height sql.NullInt64
+	if err := db.QueryRow("select max(height_id) from stats").Scan(&height); err != nil {
+		return err
+	}
+	if height.Valid {
+		mutex.Lock()
+		currentDBHeight = int(height.Int64)
+		mutex.Unlock()
 	}
+	return nil
+}
 
+// Highest height stored in the DB as of the last getDBHeight or cacheBlocks
+func getCachedDBHeight() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return currentDBHeight
 }
 
+// Load the blocks within the memory retention period
 func loadDBStatsToMemory() {
 	type DBResult struct {
 		HeightID   int     `json:"height_id"`
@@ -135,7 +214,7 @@ func loadDBStatsToMemory() {
 		Miningaddr string  `json:"miningaddr"`
 	}
 
-	results, err := db.Query("select height_id, blockhash, epoch, coins, miningaddr from stats")
+	results, err := db.Query("select height_id, blockhash, epoch, coins, miningaddr from stats where epoch >= ?", getMemoryRetentionStart())
 	if err != nil {
 		panic(err.Error())
 	}
@@ -154,6 +233,9 @@ func loadDBStatsToMemory() {
 		myStatResult.Time = dbResult.Epoch
 		mutex.Lock()
 		blockMap[dbResult.HeightID] = myStatResult
+		if dbResult.HeightID < lowestDBHeight {
+			lowestDBHeight = dbResult.HeightID
+		}
 		mutex.Unlock()
 	}
 
@@ -178,117 +260,49 @@ func getCurrentHour(loc *time.Location) int {
 	return myTime.Hour()
 }
 
-// Make RPC to POGO and update pogoCoins
-func getPogoInfoForAddr(addr string, loc *time.Location) {
-
-	startEpoch := getHourStart(0, loc) + 60 // Wait 1 minute past the hour to get new data from POGO...
-	curEpoch := time.Now().In(loc).Unix()
-	if curVal, ok := pogoCoins[addr]; ok {
-		if curVal.lastUpdate > startEpoch && (curEpoch-curVal.lastUpdate) < 600 {
-			fmt.Printf("No need to get new info from POGO!\n")
-			return
-		}
-	}
-
-	fmt.Printf("Getting new info from POGO!\n")
-	var newPogoInfoForAddr pogoInfoForAddr
-	var newCoinsAtTimes = make(map[int64]float64)
-	newPogoInfoForAddr.coinsAtTimes = newCoinsAtTimes
-	newPogoInfoForAddr.lastUpdate = time.Now().Unix()
-	mutex.Lock()
-	pogoCoins[addr] = newPogoInfoForAddr
-
-	type PogoResp struct {
-		Combined struct {
-			UnpaidBalanceAtoms int `json:"UnpaidBalanceAtoms"`
-			RecentPayouts      []struct {
-				CreatedAt int `json:"CreatedAt"`
-				Atoms     int `json:"Atoms"`
-			} `json:"RecentPayouts"`
-		} `json:"combined"`
-	}
-
-	var thisPogo PogoResp
-
-	reqUrl := url.URL{
-		Scheme: "https",
-		Host:   "pogo.dmo-tools.com",
-		Path:   "api/v1/stats/" + addr,
-	}
-
-	resp, err := http.Get(reqUrl.String())
-	if err != nil {
-		log.Printf("Unable to make request to dmo-tools: %s", err.Error())
-		mutex.Unlock()
-		return
-	}
-	bodyText, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Unable to make request to dmo-tools: %s", err.Error())
-		mutex.Unlock()
-		return
-	}
-
-	if err := json.Unmarshal(bodyText, &thisPogo); err != nil {
-		log.Printf("Unable to make request to dmo-statservice: %s", err.Error())
-		mutex.Unlock()
-		return
-	}
+// Blocks written to the DB per transaction while syncing
+const syncBatchSize = 100
 
-	for _, payout := range thisPogo.Combined.RecentPayouts {
-		pogoCoins[addr].coinsAtTimes[int64(payout.CreatedAt)] = float64(payout.Atoms) / 100000000
-	}
-	pogoCoins[addr].coinsAtTimes[curEpoch] = float64(thisPogo.Combined.UnpaidBalanceAtoms) / 100000000
-	mutex.Unlock()
+// Held for a whole sync so two syncs never ingest the same blocks at once
+var syncMutex = &sync.Mutex{}
 
-}
+// Load blocks from node up to current block. Stops early, between batches, when ctx is done. Blocks
+// only reach blockMap once their batch is committed, so memory never has blocks the DB doesn't.
+func updateStats(ctx context.Context) error {
+	syncMutex.Lock()
+	defer syncMutex.Unlock()
 
-// Load blocks from node up to current block. Do not expose RPC server until this is done. Display some output to user
-func updateStats() {
 	var err error
 
 	currentHeight, err = getCurrentHeight()
 
 	var noNode = false
 	if err != nil {
-		currentHeight = currentDBHeight
-		fmt.Printf("Unable to connect to node, using cached DB data\n")
+		currentHeight = getCachedDBHeight()
+		logger.warn("unable to connect to node, using cached DB data", "error", err)
+		recordNodeUnreachable(err)
 		noNode = true
 	} else {
-
-		fmt.Printf("Current block height from node: %d\n", currentHeight)
-	}
-
-	type DBResult struct {
-		HeightID int `json:"height_id"`
+		recordNodeHeight(currentHeight)
+		logger.debug("current block height from node", "height", currentHeight)
 	}
 
-	getDBHeight()
-
-	results, err := db.Query("select height_id from stats order by height_id asc limit 0,1")
-	if err != nil {
-		panic(err.Error())
+	if err = getDBHeight(); err != nil {
+		return err
 	}
 
-	for results.Next() {
-		var dbResult DBResult
-		err = results.Scan(&dbResult.HeightID)
-		if err != nil {
-			panic(err.Error()) // proper error handling instead of panic in your app
-		}
-		lowestDBHeight = dbResult.HeightID
-	}
+	dbHeight := getCachedDBHeight()
 
-	var startHeight = currentDBHeight
+	var startHeight = dbHeight
 
-	if startHeight < (currentHeight - blockHistoryDepth) {
-		startHeight = currentHeight - blockHistoryDepth
+	if startHeight < (currentHeight - getBlockHistoryDepth()) {
+		startHeight = currentHeight - getBlockHistoryDepth()
 	} else {
-		startHeight = currentDBHeight + 1
+		startHeight = dbHeight + 1
 	}
 
 	if noNode {
-		return
+		return nil
 	}
 
 	netHash, err2 := getCurrentNethash()
@@ -297,36 +311,134 @@ func updateStats() {
 	}
 
 	blockIDToGet := startHeight
-	fmt.Printf("Grabbing %d new blocks from node...\n", currentHeight-blockIDToGet)
-
-	var myBlockInfo blockInformation
-	for blockIDToGet < currentHeight {
-		myBlockInfo = getFullBlockInfoForHeight(blockIDToGet)
-		mutex.Lock()
-		blockMap[myBlockInfo.Height] = myBlockInfo // Add to memory cache
-		mutex.Unlock()
-		insert, err := db.Query(`
-			INSERT INTO stats (height_id, blockhash, epoch, coins, miningaddr) VALUES (?, ?, ?, ?, ?)`,
-			blockIDToGet, myBlockInfo.Hash, myBlockInfo.Time, myBlockInfo.Coins, myBlockInfo.Addr)
-
-		if err != nil {
-			panic(err.Error())
+	logger.info("grabbing new blocks from node", "blocks", currentHeight-blockIDToGet, "height", blockIDToGet)
+
+	nextHeight := startHeight
+	var newBlocks []blockInformation
+	var batch []blockInformation
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
 		}
-		insert.Close()
+		if err := storeBlocks(batch, true); err != nil {
+			return err
+		}
+		addBlocksToMemory(batch)
+		newBlocks = append(newBlocks, batch...)
+		nextHeight = batch[len(batch)-1].Height + 1
+		batch = nil
+		return nil
+	}
+
+	var fetchErr error
+	for blockIDToGet < currentHeight && err == nil {
+		if ctx.Err() != nil {
+			logger.info("stopping sync for shutdown", "height", blockIDToGet)
+			break
+		}
+		block, blockErr := getFullBlockInfoForHeight(blockIDToGet)
+		if blockErr != nil {
+			// Blocks before this one are still stored, the next sync carries on from here
+			var unreachable *nodeUnreachableError
+			if errors.As(blockErr, &unreachable) {
+				recordNodeUnreachable(blockErr)
+			}
+			fetchErr = fmt.Errorf("reading block %d from node: %w", blockIDToGet, blockErr)
+			break
+		}
+		batch = append(batch, block)
 
 		blockIDToGet++
+		if len(batch) >= syncBatchSize {
+			err = flush()
+		}
 		if (blockIDToGet % 500) == 0 {
-			fmt.Printf("Grabbed up to block id %d\n", blockIDToGet)
+			logger.info("grabbed blocks", "height", blockIDToGet)
 		}
 	}
-	fmt.Printf("DB update from Node is complete!\n")
+	if err == nil {
+		err = flush()
+	}
+	recordSync(nextHeight, newBlocks)
+	publishStatsDelta(newBlocks)
+	if err != nil {
+		return fmt.Errorf("storing blocks from height %d: %w", nextHeight, err)
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+	logger.info("DB update from node is complete", "height", nextHeight-1, "new_blocks", len(newBlocks))
+	return nil
+}
+
+// Write blocks in one transaction. Heights already stored are overwritten, so storing the same
+// blocks twice is harmless. New blocks from the sync have their webhook deliveries queued in the
+// same transaction.
+func storeBlocks(blocks []blockInformation, queueWebhooks bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholders := make([]string, 0, len(blocks))
+	args := make([]interface{}, 0, len(blocks)*5)
+	for _, block := range blocks {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?)")
+		args = append(args, block.Height, block.Hash, block.Time, block.Coins, block.Addr)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO stats (height_id, blockhash, epoch, coins, miningaddr) VALUES `+strings.Join(placeholders, ", ")+`
+		ON DUPLICATE KEY UPDATE blockhash = VALUES(blockhash), epoch = VALUES(epoch), coins = VALUES(coins), miningaddr = VALUES(miningaddr)`,
+		args...)
+	if err != nil {
+		return err
+	}
+	if queueWebhooks {
+		for _, block := range blocks {
+			if err = queueBlockWebhooks(tx, block); err != nil {
+				return err
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if queueWebhooks {
+		wakeWebhookSender()
+	}
+	return nil
+}
 
+// Add stored blocks to the memory cache and tell streams and metrics about them
+func addBlocksToMemory(blocks []blockInformation) {
+	cacheBlocks(blocks)
+
+	for _, block := range blocks {
+		publishBlockEvent(block)
+		observeIngestedBlock(block)
+	}
+}
+
+func cacheBlocks(blocks []blockInformation) {
+	mutex.Lock()
+	for _, block := range blocks {
+		blockMap[block.Height] = block
+		if block.Height < lowestDBHeight {
+			lowestDBHeight = block.Height
+		}
+		if block.Height > currentDBHeight {
+			currentDBHeight = block.Height
+		}
+	}
+	mutex.Unlock()
 }
 
 type mineRPC struct {
-	Addresses string
-	NumDays   int
-	TimeZone  string
+	Addresses string `form:"addresses"`
+	Group     string `form:"group"` // Name of an address group, used instead of Addresses
+	NumDays   int    `form:"numDays"`
+	TimeZone  string `form:"timeZone"`
 }
 
 func contains(s []string, str string) bool {
@@ -343,45 +455,101 @@ func contains(s []string, str string) bool {
 {
     "Addresses": "dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvm,kljdsalkjsadlksajd",
 }
+or, for an address group:
+{
+    "Group": "myfarm",
+}
+or the same as GET query parameters:
+/getminingstats?addresses=dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvm&numDays=7&timeZone=America/Chicago
 */
-// TODO: Do not allow more than 10 receiving addresses
-// For each addr, call getPogoInfoForAddr if the last time it was updated for that addr is before the beginning of the current hour
-// When adding up coin counts, include the pogo info.
+// Addresses must be valid DMO addresses, requests for more than MaxAddresses of them are rejected.
+// Each addr is added to the pool poller, pool info is served from whatever the poller has cached.
+// When adding up coin counts, include the pool info.
 func getAddrMiningStatsRPC(c *gin.Context) {
 	var jsonBody mineRPC
 
-	if err := c.BindJSON(&jsonBody); err != nil {
-		fmt.Printf("Got unhandled (bad) request!")
+	if err := bindStatsRequest(c, &jsonBody); err != nil {
+		abortWithBindError(c, err)
 		return
 	}
 
-	type HourStat struct {
-		Hour       int
-		Coins      float64
-		ChainCoins float64
-		WinPercent float64
+	thisResponse, ok := getMiningStats(c, jsonBody)
+	if !ok {
+		return
 	}
 
-	var hourStats []HourStat
-	ipFrom := c.ClientIP()
-	fmt.Printf("Request from %s: Getting stats for addresse(s) %s\n", ipFrom, jsonBody.Addresses)
+	c.JSON(200, thisResponse)
+}
+
+type HourStat struct {
+	Hour int
+	CoinStat
+}
+
+type DayStat struct {
+	Day string
+	CoinStat
+}
+
+type MiningStats struct {
+	HourlyStats         []HourStat
+	DailyStats          []DayStat
+	ProjectedCoinsToday float64
+	NetHash             float64
+	AddressStats        []AddrStat
+	FiatCurrency        string
+	PoolStatus          []PoolAddrStatus
+}
 
-	// load time zone
-	if jsonBody.TimeZone == "" {
-		jsonBody.TimeZone = "UTC"
+// Validate a stats request and build the stats for it. On a bad request the error response
+// has already been sent and ok is false.
+func getMiningStats(c *gin.Context, jsonBody mineRPC) (thisResponse MiningStats, ok bool) {
+	if jsonBody.Group != "" {
+		addresses, err := getAddrGroupAddresses(jsonBody.Group)
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+			return thisResponse, false
+		}
+		jsonBody.Addresses = addresses
+	}
+
+	addrsToCheck, err := parseAddresses(jsonBody.Addresses)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidAddress, err.Error())
+		return thisResponse, false
+	}
+	if len(addrsToCheck) == 0 {
+		abortWithError(c, http.StatusBadRequest, errCodeMissingAddresses, "addresses or group is required")
+		return thisResponse, false
+	}
+	if len(addrsToCheck) > getMaxAddresses() {
+		abortWithError(c, http.StatusBadRequest, errCodeTooManyAddresses, fmt.Sprintf("at most %d addresses can be requested", getMaxAddresses()))
+		return thisResponse, false
+	}
+	jsonBody.Addresses = strings.Join(addrsToCheck, ",")
+
+	if !apiKeyAllows(c, jsonBody.Group, addrsToCheck) {
+		abortWithError(c, http.StatusForbidden, errCodeForbidden, "api key is not allowed to query these addresses")
+		return thisResponse, false
 	}
-	loc, e := time.LoadLocation(jsonBody.TimeZone)
 
-	if e != nil {
-		fmt.Printf("Unable to get location for tz: %s\n", e.Error())
-		loc, _ = time.LoadLocation("UTC") // This should always work...
+	loc, err := parseTimeZone(jsonBody.TimeZone)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidTimeZone, err.Error())
+		return thisResponse, false
 	}
 
-	addrsToCheck := strings.Split(jsonBody.Addresses, ",")
-	for i := 0; i < len(addrsToCheck); i++ {
-		getPogoInfoForAddr(addrsToCheck[i], loc)
+	numDays, err := parseNumDays(jsonBody.NumDays)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidRange, err.Error())
+		return thisResponse, false
 	}
 
+	var hourStats []HourStat
+	requestLog(c).debug("getting mining stats", "addresses", len(addrsToCheck), "num_days", numDays)
+
+	subscribePoolAddrs(addrsToCheck)
+
 	hoursToday := getCurrentHour(loc)
 	for i := 0; i <= hoursToday; i++ {
 		curHour := i - hoursToday
@@ -389,48 +557,21 @@ func getAddrMiningStatsRPC(c *gin.Context) {
 		endEpoch := startEpoch + 3600
 		var thisHour HourStat
 
-		thisHour.Coins = getCoinsInEpochRange(startEpoch, endEpoch, jsonBody.Addresses)
-		thisHour.ChainCoins = getCoinsInEpochRange(startEpoch, endEpoch, "")
-		if thisHour.Coins > 0.1 && thisHour.ChainCoins > 0.1 {
-			thisHour.WinPercent = thisHour.Coins * 100.0 / thisHour.ChainCoins
-		} else {
-			thisHour.WinPercent = 0.0
-		}
+		thisHour.CoinStat = getCoinStatInEpochRange(startEpoch, endEpoch, jsonBody.Addresses)
 		thisHour.Hour = i
 		hourStats = append(hourStats, thisHour)
 
 	}
 
-	type DayStat struct {
-		Day        string
-		Coins      float64
-		ChainCoins float64
-		WinPercent float64
-	}
-
 	var dayStats []DayStat
 
-	numDays := jsonBody.NumDays
-	if numDays < 2 {
-		numDays = 2
-	}
-	if numDays > 21 {
-		numDays = 21
-	}
 	for i := 0; i <= numDays; i++ {
 		curDay := i - numDays
 		startEpoch := getDayStart(curDay, loc)
 		endEpoch := startEpoch + 86400
 		var thisDay DayStat
 
-		thisDay.Coins = getCoinsInEpochRange(startEpoch, endEpoch, jsonBody.Addresses)
-		thisDay.ChainCoins = getCoinsInEpochRange(startEpoch, endEpoch, "")
-
-		if thisDay.Coins > 0.1 && thisDay.ChainCoins > 0.1 {
-			thisDay.WinPercent = thisDay.Coins * 100.0 / thisDay.ChainCoins
-		} else {
-			thisDay.WinPercent = 0.0
-		}
+		thisDay.CoinStat = getCoinStatInEpochRange(startEpoch, endEpoch, jsonBody.Addresses)
 		formattedTime := time.Unix(startEpoch, 0).In(loc).Format("2006-01-02")
 		if i < numDays {
 			thisDay.Day = formattedTime
@@ -440,25 +581,20 @@ func getAddrMiningStatsRPC(c *gin.Context) {
 		dayStats = append(dayStats, thisDay)
 	}
 
-	type ResponseStats struct {
-		HourlyStats         []HourStat
-		DailyStats          []DayStat
-		ProjectedCoinsToday float64
-		NetHash             float64
-	}
-
 	secondsSoFarToday := float64(time.Now().Unix()-getDayStart(0, loc)) + 1.0
 
-	var thisResponse ResponseStats
 	thisResponse.NetHash = globalNetHash
+	thisResponse.FiatCurrency = getFiatCurrency()
+	thisResponse.PoolStatus = getPoolAddrStatus(addrsToCheck)
 	thisResponse.ProjectedCoinsToday = dayStats[len(dayStats)-1].Coins * (86400.0 / secondsSoFarToday)
 	thisResponse.HourlyStats = hourStats
 	thisResponse.DailyStats = dayStats
+	thisResponse.AddressStats = getAddrStats(addrsToCheck, getDayStart(-numDays, loc), time.Now().Unix()+1)
 
-	c.JSON(200, thisResponse)
+	return thisResponse, true
 }
 
-// Get lowest and highest block for epoch range
+// Get lowest and highest block for epoch range. Caller must hold the mutex.
 func findBlocksForEpochRange(startEpoch int64, endEpoch int64) (int, int) {
 	lowest := lowestDBHeight
 	highest := currentDBHeight
@@ -495,20 +631,73 @@ func findBlocksForEpochRange(startEpoch int64, endEpoch int64) (int, int) {
 // Get the number of coins in a given epoch range. If addresses is passed, limit count to coins
 // for those addresses. If not then just get all mined coins in range count...
 func getCoinsInEpochRange(startEpoch int64, endEpoch int64, addresses string) float64 {
-	addrsToCheck := strings.Split(addresses, ",")
 	numCoins := 0.0
 
+	mutex.Lock()
+	defer mutex.Unlock()
+	forEachCoinsInEpochRange(startEpoch, endEpoch, addresses, func(epoch int64, coins float64, provider string) {
+		numCoins += coins
+	})
+
+	return numCoins
+}
+
+// Coins for a set of addresses over a period of time, with solo and pool coins kept apart
+type CoinStat struct {
+	Coins      float64 // Solo and pool coins together
+	SoloCoins  float64
+	PoolCoins  map[string]float64 // Key is the pool provider name
+	ChainCoins float64
+	WinPercent float64 // Solo coins as a percent of all coins mined on chain
+	FiatValue  float64
+	BTCValue   float64
+}
+
+func getCoinStatInEpochRange(startEpoch int64, endEpoch int64, addresses string) CoinStat {
+	var stat CoinStat
+	stat.PoolCoins = make(map[string]float64)
+
+	mutex.Lock()
+	for _, name := range getPoolProviderNames() {
+		stat.PoolCoins[name] = 0.0
+	}
+	forEachCoinsInEpochRange(startEpoch, endEpoch, addresses, func(epoch int64, coins float64, provider string) {
+		stat.Coins += coins
+		if provider == "" {
+			stat.SoloCoins += coins
+		} else {
+			stat.PoolCoins[provider] += coins
+		}
+	})
+	mutex.Unlock()
+
+	stat.ChainCoins = getCoinsInEpochRange(startEpoch, endEpoch, "")
+	stat.FiatValue, stat.BTCValue = getValueInEpochRange(startEpoch, endEpoch, addresses)
+	if stat.SoloCoins > 0.1 && stat.ChainCoins > 0.1 {
+		stat.WinPercent = stat.SoloCoins * 100.0 / stat.ChainCoins
+	}
+
+	return stat
+}
+
+// Call fn with the time and amount of every mined block and pool earning counted by getCoinsInEpochRange.
+// provider is the pool name for pool earnings and empty for solo mined blocks. Caller must hold the mutex.
+func forEachCoinsInEpochRange(startEpoch int64, endEpoch int64, addresses string, fn func(epoch int64, coins float64, provider string)) {
+	addrsToCheck := strings.Split(addresses, ",")
+
 	lowest, highest := findBlocksForEpochRange(startEpoch, endEpoch)
 
-	// Add POGO counts for this epoch range here
-	for j := 0; j < len(addrsToCheck); j++ {
-		for pogoEpoch, coins := range pogoCoins[addrsToCheck[j]].coinsAtTimes {
-			// Shift the payout time back by 1 minute so it falls into the previous hour since it was
-			// coins paid out FOR the previous hour.
-			pogoEpoch -= 60
-			if startEpoch <= pogoEpoch && pogoEpoch < endEpoch {
-				numCoins += coins
+	// Add pool counts for this epoch range here
+	for name, addrPoolCoins := range poolCoins {
+		provider := name
+		for j := 0; j < len(addrsToCheck); j++ {
+			thisPoolInfo, ok := addrPoolCoins[addrsToCheck[j]]
+			if !ok {
+				continue
 			}
+			forEachPoolEarningInEpochRange(thisPoolInfo, startEpoch, endEpoch, func(epoch int64, coins float64) {
+				fn(epoch, coins, provider)
+			})
 		}
 	}
 
@@ -517,27 +706,90 @@ func getCoinsInEpochRange(startEpoch int64, endEpoch int64, addresses string) fl
 			if len(addrsToCheck) > 0 && len(addrsToCheck[0]) > 0 {
 				if contains(addrsToCheck, block.Addr) {
 					if startEpoch < int64(block.Time) && int64(block.Time) < endEpoch {
-						numCoins += block.Coins
+						fn(int64(block.Time), block.Coins, "")
 					}
 				}
 			} else {
 				if startEpoch < int64(block.Time) && int64(block.Time) < endEpoch {
-					numCoins += block.Coins
+					fn(int64(block.Time), block.Coins, "")
 				}
 			}
 		}
 	}
-
-	return numCoins
 }
 
-func getFullBlockInfoForHeight(height int) blockInformation {
+func getFullBlockInfoForHeight(height int) (blockInformation, error) {
 	var myBlockInfo blockInformation
 	myBlockInfo.Height = height
-	myBlockInfo = getBlockHash(myBlockInfo)
-	myBlockInfo = getBlock(myBlockInfo)
-	myBlockInfo = getTransInfo(myBlockInfo)
-	return myBlockInfo
+	myBlockInfo, err := getBlockHash(myBlockInfo)
+	if err != nil {
+		return myBlockInfo, err
+	}
+	myBlockInfo, err = getBlock(myBlockInfo)
+	if err != nil {
+		return myBlockInfo, err
+	}
+	return getTransInfo(myBlockInfo)
+}
+
+// Error object in a node RPC response, a request the node couldn't answer rather than an
+// unreachable node
+type nodeRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *nodeRPCError) Error() string {
+	return fmt.Sprintf("node error %d: %s", e.Code, e.Message)
+}
+
+// The node couldn't be reached or stopped answering mid request, as opposed to a request it
+// answered with an error or a response we can't use
+type nodeUnreachableError struct {
+	method string
+	err    error
+}
+
+func (e *nodeUnreachableError) Error() string {
+	return fmt.Sprintf("calling %s: %v", e.method, e.err)
+}
+
+func (e *nodeUnreachableError) Unwrap() error {
+	return e.err
+}
+
+// Client for the per block RPCs, so a node that stops answering can't stall the sync forever
+var nodeClient = &http.Client{Timeout: 30 * time.Second}
+
+// Send a json RPC request to the node and decode the response into result
+func callNode(method string, body string, result interface{}) error {
+	reqURL := url.URL{
+		Scheme: "http",
+		Host:   c.NodeIP + ":" + c.NodePort,
+		Path:   "",
+	}
+
+	req, err := http.NewRequest("POST", reqURL.String(), bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.NodeUser, c.NodePass)
+	start := time.Now()
+	resp, err := nodeClient.Do(req)
+	observeNodeRPC(method, start, err)
+	if err != nil {
+		return &nodeUnreachableError{method: method, err: err}
+	}
+	defer resp.Body.Close()
+
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &nodeUnreachableError{method: method, err: fmt.Errorf("reading response: %w", err)}
+	}
+	if err := json.Unmarshal(bodyText, result); err != nil {
+		return fmt.Errorf("decoding %s response (http status %d): %w", method, resp.StatusCode, err)
+	}
+	return nil
 }
 
 func getCurrentNethash() (float64, error) {
@@ -561,7 +813,9 @@ func getCurrentNethash() (float64, error) {
 	}
 
 	req.SetBasicAuth(c.NodeUser, c.NodePass)
+	start := time.Now()
 	resp, err := client.Do(req)
+	observeNodeRPC("getnetworkhashps", start, err)
 	if err != nil {
 		return 0, err
 	}
@@ -600,7 +854,9 @@ func getCurrentHeight() (int, error) {
 	}
 
 	req.SetBasicAuth(c.NodeUser, c.NodePass)
+	start := time.Now()
 	resp, err := client.Do(req)
+	observeNodeRPC("getblockcount", start, err)
 	if err != nil {
 		return 0, err
 	}
@@ -618,49 +874,32 @@ func getCurrentHeight() (int, error) {
 }
 
 // Step one, get the block hash for the block number
-func getBlockHash(blockInfo blockInformation) blockInformation {
+func getBlockHash(blockInfo blockInformation) (blockInformation, error) {
 
 	type blockHashResult struct {
-		ID     string `json:"id"`
-		Result string `json:"result"`
-	}
-
-	client := &http.Client{}
-	reqURL := url.URL{
-		Scheme: "http",
-		Host:   c.NodeIP + ":" + c.NodePort,
-		Path:   "",
+		ID     string        `json:"id"`
+		Result string        `json:"result"`
+		Error  *nodeRPCError `json:"error"`
 	}
 
-	var data = bytes.NewBufferString(`{"jsonrpc":"1.0","id":"curltest","method":"getblockhash", "params": { "height": ` + strconv.Itoa(blockInfo.Height) + `}}`)
-	req, err := http.NewRequest("POST", reqURL.String(), data)
+	var myBlockHash blockHashResult
+	err := callNode("getblockhash", `{"jsonrpc":"1.0","id":"curltest","method":"getblockhash", "params": { "height": `+strconv.Itoa(blockInfo.Height)+`}}`, &myBlockHash)
 	if err != nil {
-		log.Fatalf("Unable to construct getblockhash request to %q: %s", reqURL.String(), err)
+		return blockInfo, err
 	}
-
-	req.SetBasicAuth(c.NodeUser, c.NodePass)
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal(err)
-		return blockInfo
+	if myBlockHash.Error != nil {
+		return blockInfo, myBlockHash.Error
 	}
-	bodyText, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Unable to read response body for getblockhash request: %s", err)
-	}
-
-	var myBlockHash blockHashResult
-
-	if err := json.Unmarshal(bodyText, &myBlockHash); err != nil {
-		return blockInfo
+	if myBlockHash.Result == "" {
+		return blockInfo, fmt.Errorf("no block hash for height %d", blockInfo.Height)
 	}
 	blockInfo.Hash = myBlockHash.Result
 
-	return blockInfo
+	return blockInfo, nil
 }
 
 // Step two, get the block for the hash... returns a txid IF IT WAS A MINED BLOCK
-func getBlock(blockInfo blockInformation) blockInformation {
+func getBlock(blockInfo blockInformation) (blockInformation, error) {
 	type blockResult struct {
 		Result struct {
 			Hash              string   `json:"hash"`
@@ -683,57 +922,29 @@ func getBlock(blockInfo blockInformation) blockInformation {
 			Weight            int      `json:"weight"`
 			Tx                []string `json:"tx"`
 		} `json:"result"`
-		Error interface{} `json:"error"`
-		ID    string      `json:"id"`
-	}
-
-	client := &http.Client{}
-	reqURL := url.URL{
-		Scheme: "http",
-		Host:   c.NodeIP + ":" + c.NodePort,
-		Path:   "",
+		Error *nodeRPCError `json:"error"`
+		ID    string        `json:"id"`
 	}
 
-	var data = bytes.NewBufferString(`{"jsonrpc":"1.0","id":"curltest","method":"getblock", "params": { "blockhash": "` + blockInfo.Hash + `"}}`)
-	req, err := http.NewRequest("POST", reqURL.String(), data)
-	if err != nil {
-		log.Fatalf("Unable to construct getblock request to %q: %s", reqURL.String(), err)
-	}
-	req.SetBasicAuth(c.NodeUser, c.NodePass)
-	resp, err := client.Do(req)
+	var myBlock blockResult
+	err := callNode("getblock", `{"jsonrpc":"1.0","id":"curltest","method":"getblock", "params": { "blockhash": "`+blockInfo.Hash+`"}}`, &myBlock)
 	if err != nil {
-		log.Fatal(err)
-		return blockInfo
+		return blockInfo, err
 	}
-
-	bodyText, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Unable to read response body for getblock request: %s", err)
+	if myBlock.Error != nil {
+		return blockInfo, myBlock.Error
 	}
-
-	var myBlock blockResult
-
-	if err := json.Unmarshal(bodyText, &myBlock); err != nil {
-		return blockInfo
+	if len(myBlock.Result.Tx) == 0 {
+		return blockInfo, fmt.Errorf("block %d has no transactions", blockInfo.Height)
 	}
 
 	blockInfo.Time = myBlock.Result.Time
 	blockInfo.TxID = myBlock.Result.Tx[0]
-	return blockInfo
-}
-
-type minedTxInfo struct {
-	miningAddr string
-	coins      float64
+	return blockInfo, nil
 }
 
 // Step three, get the information I care about
-func getTransInfo(blockInfo blockInformation) blockInformation {
-
-	var myInfo minedTxInfo
-
-	myInfo.miningAddr = "professorminingaddr"
-	myInfo.coins = 1.001
+func getTransInfo(blockInfo blockInformation) (blockInformation, error) {
 
 	type TransResponse struct {
 		Result struct {
@@ -766,44 +977,29 @@ func getTransInfo(blockInfo blockInformation) blockInformation {
 			Time          int    `json:"time"`
 			Blocktime     int    `json:"blocktime"`
 		} `json:"result"`
-		Error interface{} `json:"error"`
-		ID    string      `json:"id"`
+		Error *nodeRPCError `json:"error"`
+		ID    string        `json:"id"`
 	}
 
-	client := &http.Client{}
-	reqURL := url.URL{
-		Scheme: "http",
-		Host:   c.NodeIP + ":" + c.NodePort,
-		Path:   "",
-	}
-
-	var data = bytes.NewBufferString(`{"jsonrpc":"1.0","id":"curltest","method":"getrawtransaction", "params": { "blockhash": "` + blockInfo.Hash + `", "txid": "` + blockInfo.TxID + `", "verbose": true}}`)
-	req, err := http.NewRequest("POST", reqURL.String(), data)
+	var myTrans TransResponse
+	err := callNode("getrawtransaction", `{"jsonrpc":"1.0","id":"curltest","method":"getrawtransaction", "params": { "blockhash": "`+blockInfo.Hash+`", "txid": "`+blockInfo.TxID+`", "verbose": true}}`, &myTrans)
 	if err != nil {
-		log.Fatalf("Unable to construct getrawtransaction request to %q: %s", reqURL.String(), err)
+		return blockInfo, err
 	}
-
-	req.SetBasicAuth(c.NodeUser, c.NodePass)
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal(err)
-		return blockInfo
+	// The genesis coinbase isn't a real transaction, the node can't return it and its coins can
+	// never be spent, so the block is kept with no address and no coins
+	if myTrans.Error != nil && blockInfo.Height == 0 {
+		return blockInfo, nil
 	}
-	bodyText, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Unable to read getrawtransaction body: %s", err)
+	if myTrans.Error != nil {
+		return blockInfo, myTrans.Error
 	}
-
-	//fmt.Printf("Raw trans info: %s\n", bodyText)
-
-	var myTrans TransResponse
-
-	if err := json.Unmarshal(bodyText, &myTrans); err != nil {
-		return blockInfo
+	if len(myTrans.Result.Vin) == 0 || len(myTrans.Result.Vout) == 0 {
+		return blockInfo, fmt.Errorf("transaction %s in block %d has no inputs or outputs", blockInfo.TxID, blockInfo.Height)
 	}
 
 	if myTrans.Result.Vout[0].Value > 2.0 {
-		fmt.Printf("Coinbase value %s, coins %.2f\n", myTrans.Result.Vin[0].Coinbase, myTrans.Result.Vout[0].Value)
+		logger.debug("large coinbase value", "height", blockInfo.Height, "coinbase", myTrans.Result.Vin[0].Coinbase, "coins", myTrans.Result.Vout[0].Value)
 	}
 
 	blockInfo.Addr = myTrans.Result.Vout[0].ScriptPubKey.Address
@@ -814,6 +1010,6 @@ func getTransInfo(blockInfo blockInformation) blockInformation {
 		blockInfo.Coins = 0.0 // If it wasn't a MINED transaction, don't count the coins!
 	}
 
-	return blockInfo
+	return blockInfo, nil
 
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCallNodeUnreachable(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc // Nil for a node that isn't listening
+		unreachable bool
+	}{
+		{"not listening", nil, true},
+		{"error object", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"result":null,"error":{"code":-8,"message":"Block height out of range"}}`))
+		}, false},
+		{"not json", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}, false},
+	}
+	for _, test := range tests {
+		var addr string
+		if test.handler != nil {
+			server := httptest.NewServer(test.handler)
+			defer server.Close()
+			addr = server.Listener.Addr().String()
+		} else {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr = listener.Addr().String()
+			listener.Close()
+		}
+		c.NodeIP, c.NodePort, _ = net.SplitHostPort(addr)
+
+		var result struct {
+			Error *nodeRPCError `json:"error"`
+		}
+		err := callNode("getblockhash", `{}`, &result)
+		var unreachable *nodeUnreachableError
+		if errors.As(err, &unreachable) != test.unreachable {
+			t.Errorf("%s: got %v, unreachable should be %v", test.name, err, test.unreachable)
+		}
+	}
+}
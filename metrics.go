@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics are kept here and written in the Prometheus text format by /metrics. Gauges that mirror
+// state kept elsewhere (heights, cache size) are read when scraped instead of being stored.
+
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]float64 // Key is the label values joined with \xff
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	mutex   sync.Mutex
+	values  map[string]*histogram
+}
+
+func newCounterVec(name string, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func newHistogramVec(name string, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+}
+
+func (m *counterVec) add(value float64, labelValues ...string) {
+	m.mutex.Lock()
+	m.values[strings.Join(labelValues, "\xff")] += value
+	m.mutex.Unlock()
+}
+
+func (m *counterVec) inc(labelValues ...string) {
+	m.add(1, labelValues...)
+}
+
+func (m *histogramVec) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	thisHistogram, ok := m.values[key]
+	if !ok {
+		thisHistogram = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.values[key] = thisHistogram
+	}
+	for i, bound := range m.buckets {
+		if value <= bound {
+			thisHistogram.counts[i]++
+			break
+		}
+	}
+	thisHistogram.count++
+	thisHistogram.sum += value
+}
+
+var (
+	blocksIngested = newCounterVec("dmo_blocks_ingested_total",
+		"Blocks read from the node and stored")
+	addrMinedCoins = newCounterVec("dmo_address_mined_coins_total",
+		"Coins from ingested blocks mined by addresses in a group or PoolAddresses", "addr")
+	nodeRPCDuration = newHistogramVec("dmo_node_rpc_duration_seconds",
+		"Latency of RPC calls to the node", defaultLatencyBuckets, "method")
+	nodeRPCErrors = newCounterVec("dmo_node_rpc_errors_total",
+		"RPC calls to the node that failed", "method")
+	poolFetches = newCounterVec("dmo_pool_fetches_total",
+		"Requests to mining pools for address data", "provider", "outcome")
+	httpRequests = newCounterVec("dmo_http_requests_total",
+		"HTTP requests served", "method", "route", "status")
+	httpRequestDuration = newHistogramVec("dmo_http_request_duration_seconds",
+		"Latency of HTTP requests served", defaultLatencyBuckets, "method", "route")
+)
+
+func observeNodeRPC(method string, start time.Time, err error) {
+	nodeRPCDuration.observe(time.Since(start).Seconds(), method)
+	if err != nil {
+		nodeRPCErrors.inc(method)
+	}
+}
+
+// Count a newly stored block towards the ingest and per address counters
+func observeIngestedBlock(block blockInformation) {
+	blocksIngested.inc()
+	if block.Coins > 0 && isConfiguredAddr(block.Addr) {
+		addrMinedCoins.add(block.Coins, block.Addr)
+	}
+}
+
+// Addresses are configured when they are in a group or PoolAddresses, which keeps the
+// per address series bounded
+func isConfiguredAddr(addr string) bool {
+	if contains(c.PoolAddresses, addr) {
+		return true
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, group := range addrGroups {
+		for _, member := range group.Members {
+			if member.Address == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware recording the count and latency of every request by its route pattern
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequests.inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	httpRequestDuration.observe(time.Since(start).Seconds(), c.Request.Method, route)
+}
+
+func metricsRPC(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	writeMetrics(c.Writer)
+}
+
+func writeMetrics(w io.Writer) {
+	health := getNodeHealth()
+	mutex.Lock()
+	cachedBlocks := len(blockMap)
+	mutex.Unlock()
+
+	nodeUp := 0.0
+	if health.Reachable {
+		nodeUp = 1
+	}
+	writeGauge(w, "dmo_node_up", "Whether the node answered the last sync", nodeUp)
+	writeGauge(w, "dmo_node_height", "Block count reported by the node", float64(health.NodeHeight))
+	writeGauge(w, "dmo_sync_height", "Highest block stored", float64(health.SyncedHeight-1))
+	writeGauge(w, "dmo_sync_lag_blocks", "Blocks the node has that are not stored yet", float64(health.NodeHeight-health.SyncedHeight))
+	writeGauge(w, "dmo_tip_time_seconds", "Time of the newest stored block", float64(health.TipTime))
+	writeGauge(w, "dmo_net_hash", "Network hash rate from the node", globalNetHash)
+	writeGauge(w, "dmo_block_cache_blocks", "Blocks held in memory", float64(cachedBlocks))
+
+	for _, counter := range []*counterVec{blocksIngested, addrMinedCoins, nodeRPCErrors, poolFetches, httpRequests} {
+		counter.write(w)
+	}
+	for _, thisHistogram := range []*histogramVec{nodeRPCDuration, httpRequestDuration} {
+		thisHistogram.write(w)
+	}
+}
+
+func writeGauge(w io.Writer, name string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatMetricValue(value))
+}
+
+func (m *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", m.name, m.help, m.name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.labels) == 0 && len(m.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", m.name)
+	}
+	for _, key := range sortedMetricKeys(m.values) {
+		fmt.Fprintf(w, "%s%s %s\n", m.name, formatMetricLabels(m.labels, key, ""), formatMetricValue(m.values[key]))
+	}
+}
+
+func (m *histogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", m.name, m.help, m.name)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	keys := make([]string, 0, len(m.values))
+	for key := range m.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		thisHistogram := m.values[key]
+		cumulative := uint64(0)
+		for i, bound := range m.buckets {
+			cumulative += thisHistogram.counts[i]
+			le := `le="` + formatMetricValue(bound) + `"`
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatMetricLabels(m.labels, key, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatMetricLabels(m.labels, key, `le="+Inf"`), thisHistogram.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, formatMetricLabels(m.labels, key, ""), formatMetricValue(thisHistogram.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, formatMetricLabels(m.labels, key, ""), thisHistogram.count)
+	}
+}
+
+func sortedMetricKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// {name="value",...} for the label values in key, with extra appended as is
+func formatMetricLabels(names []string, key string, extra string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			if i < len(names) {
+				pairs = append(pairs, names[i]+`="`+escapeMetricLabel(value)+`"`)
+			}
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeMetricLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
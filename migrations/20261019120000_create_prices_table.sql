@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+create table prices
+ (
+  id int not null auto_increment primary key,
+  epoch int(11) unsigned not null,
+  currency varchar(8) not null,
+  fiat double not null,
+  btc double not null,
+  index prices_currency_epoch (currency, epoch)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table prices;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+create table pool_payouts
+ (
+  provider varchar(32) not null,
+  address varchar(64) not null,
+  created_at int(11) unsigned not null,
+  coins double not null,
+  primary key (provider, address, created_at)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table pool_payouts;
+-- +goose StatementEnd
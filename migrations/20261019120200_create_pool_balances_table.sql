@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+create table pool_balances
+ (
+  provider varchar(32) not null,
+  address varchar(64) not null,
+  epoch int(11) unsigned not null,
+  unpaid double not null,
+  primary key (provider, address, epoch)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table pool_balances;
+-- +goose StatementEnd
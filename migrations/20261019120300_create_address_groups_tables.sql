@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+create table address_groups
+ (
+  name varchar(64) not null primary key
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create table address_group_members
+ (
+  group_name varchar(64) not null,
+  address varchar(64) not null,
+  label varchar(128) not null default '',
+  primary key (group_name, address)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table address_group_members;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+drop table address_groups;
+-- +goose StatementEnd
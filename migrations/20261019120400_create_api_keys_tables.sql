@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+create table api_keys
+ (
+  id int not null auto_increment primary key,
+  name varchar(64) not null unique,
+  key_hash char(64) not null unique,
+  admin tinyint(1) not null default 0,
+  created int(11) unsigned not null
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create table api_key_scopes
+ (
+  key_id int not null,
+  scope_type enum('address', 'group') not null,
+  value varchar(64) not null,
+  primary key (key_id, scope_type, value)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table api_key_scopes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+drop table api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+create table group_webhooks
+ (
+  id int not null auto_increment primary key,
+  group_name varchar(64) not null,
+  url varchar(512) not null,
+  secret varchar(80) not null,
+  created int(11) unsigned not null,
+  index (group_name)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create table webhook_deliveries
+ (
+  id bigint not null auto_increment primary key,
+  webhook_id int not null,
+  event varchar(32) not null,
+  payload text not null,
+  attempts int not null default 0,
+  next_attempt int(11) unsigned not null,
+  last_error varchar(255) not null default '',
+  failed tinyint(1) not null default 0,
+  created int(11) unsigned not null,
+  index (failed, next_attempt),
+  index (webhook_id)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table webhook_deliveries;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+drop table group_webhooks;
+-- +goose StatementEnd
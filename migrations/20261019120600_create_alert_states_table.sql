@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+create table alert_states
+ (
+  name varchar(128) not null primary key,
+  firing tinyint(1) not null default 0,
+  since int(11) unsigned not null,
+  summary varchar(255) not null default ''
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table alert_states;
+-- +goose StatementEnd
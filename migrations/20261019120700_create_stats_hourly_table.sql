@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+create table stats_hourly
+ (
+  hour_epoch int(11) unsigned not null,
+  miningaddr varchar(64) not null,
+  blocks int not null,
+  coins double not null,
+  primary key (hour_epoch, miningaddr)
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+create index stats_epoch on stats (epoch);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index stats_epoch on stats;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+drop table stats_hourly;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+create table compacted_ranges
+ (
+  start_height int(11) unsigned not null primary key,
+  end_height int(11) unsigned not null
+ )engine=innodb;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table compacted_ranges;
+-- +goose StatementEnd
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type NodeHealth struct {
+	Reachable        bool
+	UnreachableSince int64 // Zero while reachable
+	LastError        string
+	NodeHeight       int   // Block count reported by the node
+	SyncedHeight     int   // Next height to ingest, equal to NodeHeight when caught up
+	HeightChanged    int64 // When NodeHeight last moved
+	TipTime          int   // Time of the newest ingested block
+}
+
+var nodeHealth NodeHealth
+
+func recordNodeUnreachable(err error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if nodeHealth.Reachable || nodeHealth.UnreachableSince == 0 {
+		nodeHealth.UnreachableSince = time.Now().Unix()
+	}
+	nodeHealth.Reachable = false
+	nodeHealth.LastError = err.Error()
+}
+
+func recordNodeHeight(height int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	nodeHealth.Reachable = true
+	nodeHealth.UnreachableSince = 0
+	nodeHealth.LastError = ""
+	if height != nodeHealth.NodeHeight {
+		nodeHealth.NodeHeight = height
+		nodeHealth.HeightChanged = time.Now().Unix()
+	}
+}
+
+// Record the end of a sync, nextHeight is the first height not yet ingested
+func recordSync(nextHeight int, newBlocks []blockInformation) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	nodeHealth.SyncedHeight = nextHeight
+	if len(newBlocks) > 0 {
+		nodeHealth.TipTime = newBlocks[len(newBlocks)-1].Time
+	} else if block, ok := blockMap[nextHeight-1]; ok && nodeHealth.TipTime == 0 {
+		nodeHealth.TipTime = block.Time
+	}
+}
+
+func getNodeHealth() NodeHealth {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return nodeHealth
+}
+
+func getNodeAlertMinutes(minutes int, fallback int) int64 {
+	if minutes <= 0 {
+		minutes = fallback
+	}
+	return int64(minutes)
+}
+
+// Raise or clear the node alerts, called after each sync
+func evaluateNodeHealth() {
+	if c.NodeAlerts.Disabled {
+		return
+	}
+	health := getNodeHealth()
+	now := time.Now().Unix()
+	notifierNames := c.NodeAlerts.Notifiers
+
+	nodeDownMinutes := getNodeAlertMinutes(c.NodeAlerts.NodeDownMinutes, 5)
+	if !health.Reachable {
+		down := now - health.UnreachableSince
+		setAlertState("node_unreachable", notifierNames, down >= nodeDownMinutes*60,
+			fmt.Sprintf("node has been unreachable for %d minutes: %s", down/60, health.LastError))
+		// The other checks need the node
+		return
+	}
+	setAlertState("node_unreachable", notifierNames, false, "node is reachable")
+
+	maxSyncLag := c.NodeAlerts.MaxSyncLag
+	if maxSyncLag <= 0 {
+		maxSyncLag = 20
+	}
+	lag := health.NodeHeight - health.SyncedHeight
+	setAlertState("node_sync_lag", notifierNames, lag > maxSyncLag,
+		fmt.Sprintf("DB is %d blocks behind the node at height %d", lag, health.NodeHeight))
+
+	if health.TipTime > 0 {
+		noNewBlockMinutes := getNodeAlertMinutes(c.NodeAlerts.NoNewBlockMinutes, 15)
+		age := now - int64(health.TipTime)
+		setAlertState("node_no_new_block", notifierNames, age >= noNewBlockMinutes*60,
+			fmt.Sprintf("newest block is %d minutes old", age/60))
+	}
+
+	staleTipMinutes := getNodeAlertMinutes(c.NodeAlerts.StaleTipMinutes, 30)
+	unchanged := now - health.HeightChanged
+	setAlertState("node_stale_tip", notifierNames, unchanged >= staleTipMinutes*60,
+		fmt.Sprintf("node height has been %d for %d minutes", health.NodeHeight, unchanged/60))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sent when an alert starts firing and again when it recovers
+type AlertNotification struct {
+	Alert   string `json:"alert"`
+	Firing  bool   `json:"firing"` // False for the recovery notification
+	Summary string `json:"summary"`
+	Since   int64  `json:"since"` // When the alert started firing
+	Time    int64  `json:"time"`
+}
+
+// One line description for notifiers that send plain text
+func (n AlertNotification) text() string {
+	state := "RESOLVED"
+	if n.Firing {
+		state = "FIRING"
+	}
+	return fmt.Sprintf("[%s] %s: %s", state, n.Alert, n.Summary)
+}
+
+type notifier interface {
+	notify(notification AlertNotification) error
+}
+
+// POSTs the notification as json, signed like the group webhooks when a secret is set
+type webhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// SMTP email, authenticating with PLAIN auth when a user is set
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+// Chat services that take a json message through an incoming webhook. Discord reads "content",
+// Slack and Telegram's sendMessage read "text", Telegram also needs the chat_id.
+type chatNotifier struct {
+	url    string
+	chatID string
+	client *http.Client
+}
+
+// Key is the notifier name from the config
+var notifiers = make(map[string]notifier)
+
+func newNotifier(thisNotifierConf notifierConf) (notifier, error) {
+	switch thisNotifierConf.Type {
+	case "webhook":
+		if err := validateWebhookURL(thisNotifierConf.URL); err != nil {
+			return nil, err
+		}
+		return &webhookNotifier{
+			url:    thisNotifierConf.URL,
+			secret: thisNotifierConf.Secret,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "smtp":
+		if thisNotifierConf.SMTPHost == "" || thisNotifierConf.From == "" || len(thisNotifierConf.To) == 0 {
+			return nil, fmt.Errorf("smtp notifiers need SMTPHost, From and To")
+		}
+		port := thisNotifierConf.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		var auth smtp.Auth
+		if thisNotifierConf.SMTPUser != "" {
+			auth = smtp.PlainAuth("", thisNotifierConf.SMTPUser, thisNotifierConf.SMTPPass, thisNotifierConf.SMTPHost)
+		}
+		return &smtpNotifier{
+			addr: thisNotifierConf.SMTPHost + ":" + strconv.Itoa(port),
+			auth: auth,
+			from: thisNotifierConf.From,
+			to:   thisNotifierConf.To,
+		}, nil
+	case "chat":
+		if err := validateWebhookURL(thisNotifierConf.URL); err != nil {
+			return nil, err
+		}
+		return &chatNotifier{
+			url:    thisNotifierConf.URL,
+			chatID: thisNotifierConf.ChatID,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", thisNotifierConf.Type)
+}
+
+// Create the notifiers listed under Notifiers in the config
+func initNotifiers() {
+	for name, thisNotifierConf := range c.Notifiers {
+		thisNotifier, err := newNotifier(thisNotifierConf)
+		if err != nil {
+			logger.fatal("invalid notifier in config", "notifier", name, "error", err)
+		}
+		notifiers[name] = thisNotifier
+		logger.info("notifier enabled", "notifier", name, "type", thisNotifierConf.Type)
+	}
+}
+
+// Notifier names in a stable order
+func getNotifierNames() []string {
+	var names []string
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send a notification to the named notifiers, all of them when names is empty. Failures are logged.
+func sendNotification(names []string, notification AlertNotification) {
+	if len(names) == 0 {
+		names = getNotifierNames()
+	}
+	for _, name := range names {
+		thisNotifier, ok := notifiers[name]
+		if !ok {
+			continue
+		}
+		if err := thisNotifier.notify(notification); err != nil {
+			logger.error("unable to send alert", "alert", notification.Alert, "notifier", name, "error", err)
+		}
+	}
+}
+
+func (n *webhookNotifier) notify(notification AlertNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"X-DMO-Event": "alert"}
+	if n.secret != "" {
+		timestamp := time.Now().Unix()
+		headers["X-DMO-Timestamp"] = strconv.FormatInt(timestamp, 10)
+		headers["X-DMO-Signature"] = signWebhookPayload(n.secret, timestamp, body)
+	}
+	return postJSON(n.client, n.url, body, headers)
+}
+
+func (n *smtpNotifier) notify(notification AlertNotification) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", n.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", notification.text())
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Unix(notification.Time, 0).UTC().Format(time.RFC1123Z))
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&message, "%s\r\n\r\nFiring since %s\r\n", notification.text(), time.Unix(notification.Since, 0).UTC().Format(time.RFC1123))
+
+	return smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(message.String()))
+}
+
+func (n *chatNotifier) notify(notification AlertNotification) error {
+	message := map[string]string{
+		"content": notification.text(),
+		"text":    notification.text(),
+	}
+	if n.chatID != "" {
+		message["chat_id"] = n.chatID
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return postJSON(n.client, n.url, body, nil)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type apiRoute struct {
+	Method   string
+	Path     string // gin style, :name for path parameters
+	Summary  string
+	Handler  gin.HandlerFunc
+	Params   interface{} // Query parameters for GET, the json body otherwise. Nil when there are none.
+	Response interface{} // Nil when the route responds with no content
+	// Content type of Response, application/json when empty
+	ContentType string
+	// Success status when there is a Response, 200 when zero
+	Status int
+	Admin  bool
+}
+
+// Builds an OpenAPI 3 document for routes by reflecting over their request and response types
+type openAPIBuilder struct {
+	schemas map[string]interface{}
+}
+
+func buildOpenAPISpec(basePath string, routes []apiRoute) map[string]interface{} {
+	builder := openAPIBuilder{schemas: make(map[string]interface{})}
+
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		path, pathParams := openAPIPath(basePath + route.Path)
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(route.Method)] = builder.operation(route, pathParams)
+	}
+
+	spec := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "dmo-statservice",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": builder.schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-API-Key",
+				},
+			},
+		},
+	}
+	if apiKeysRequired() {
+		spec["security"] = []interface{}{map[string]interface{}{"apiKey": []string{}}}
+	}
+	builder.schemaFor(reflect.TypeOf(APIErrorResponse{}))
+
+	return spec
+}
+
+// Turn /groups/:name into /groups/{name}
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			params = append(params, part[1:])
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func (b *openAPIBuilder) operation(route apiRoute, pathParams []string) map[string]interface{} {
+	var parameters []interface{}
+	for _, name := range pathParams {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+
+	operation := map[string]interface{}{
+		"summary": route.Summary,
+	}
+
+	if route.Params != nil {
+		paramsType := reflect.TypeOf(route.Params)
+		if route.Method == http.MethodGet {
+			for i := 0; i < paramsType.NumField(); i++ {
+				field := paramsType.Field(i)
+				name := strings.Split(field.Tag.Get("form"), ",")[0]
+				if name == "" || name == "-" {
+					continue
+				}
+				parameters = append(parameters, map[string]interface{}{
+					"name":   name,
+					"in":     "query",
+					"schema": b.schemaFor(field.Type),
+				})
+			}
+		} else {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": b.schemaFor(paramsType)},
+				},
+			}
+		}
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	responses := map[string]interface{}{
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": b.schemaFor(reflect.TypeOf(APIErrorResponse{}))},
+			},
+		},
+	}
+	if route.Response == nil {
+		responses["204"] = map[string]interface{}{"description": "No content"}
+	} else {
+		contentType := route.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				contentType: map[string]interface{}{"schema": b.schemaFor(reflect.TypeOf(route.Response))},
+			},
+		}
+	}
+	operation["responses"] = responses
+
+	return operation
+}
+
+// Get the schema for a type, named structs are added to the components and referenced
+func (b *openAPIBuilder) schemaFor(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Ptr:
+		return b.schemaFor(t.Elem())
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := strings.TrimSuffix(t.Name(), "V1")
+		if _, ok := b.schemas[name]; !ok {
+			b.schemas[name] = map[string]interface{}{} // Placeholder in case the type refers to itself
+			b.schemas[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func (b *openAPIBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	b.addStructProperties(t, properties)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// Add the json fields of a struct, flattening embedded structs the same way encoding/json does
+func (b *openAPIBuilder) addStructProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			b.addStructProperties(field.Type, properties)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schemaFor(field.Type)
+	}
+}
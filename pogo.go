@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const defaultPogoBaseURL = "https://pogo.dmo-tools.com/api/v1/stats/"
+
+type pogoProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+func init() {
+	registerPoolProvider("pogo", newPogoProvider)
+}
+
+func newPogoProvider(baseURL string) poolProvider {
+	if baseURL == "" {
+		baseURL = defaultPogoBaseURL
+	}
+	return &pogoProvider{
+		baseURL: baseURL,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (p *pogoProvider) getAddrInfo(addr string) (poolAddrInfo, error) {
+	var addrInfo poolAddrInfo
+
+	type PogoResp struct {
+		Combined struct {
+			UnpaidBalanceAtoms int `json:"UnpaidBalanceAtoms"`
+			RecentPayouts      []struct {
+				CreatedAt int `json:"CreatedAt"`
+				Atoms     int `json:"Atoms"`
+			} `json:"RecentPayouts"`
+		} `json:"combined"`
+	}
+
+	var thisPogo PogoResp
+
+	resp, err := p.client.Get(p.baseURL + addr)
+	if err != nil {
+		return addrInfo, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return addrInfo, fmt.Errorf("pogo returned status %d", resp.StatusCode)
+	}
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return addrInfo, err
+	}
+
+	if err := json.Unmarshal(bodyText, &thisPogo); err != nil {
+		return addrInfo, err
+	}
+
+	for _, payout := range thisPogo.Combined.RecentPayouts {
+		addrInfo.Payouts = append(addrInfo.Payouts, poolPayout{
+			CreatedAt: int64(payout.CreatedAt),
+			Coins:     float64(payout.Atoms) / 100000000,
+		})
+	}
+	addrInfo.UnpaidBalance = float64(thisPogo.Combined.UnpaidBalanceAtoms) / 100000000
+
+	return addrInfo, nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type poolPayout struct {
+	CreatedAt int64
+	Coins     float64
+}
+
+type poolAddrInfo struct {
+	Payouts       []poolPayout
+	UnpaidBalance float64
+}
+
+// A mining pool that can report what it owes and has paid a receiving address
+type poolProvider interface {
+	getAddrInfo(addr string) (poolAddrInfo, error)
+}
+
+// Builds a provider from the base URL configured for it
+type poolProviderFactory func(baseURL string) poolProvider
+
+type poolInfoForAddr struct {
+	lastUpdate  int64 // Last successful refresh
+	lastAttempt int64
+	lastError   string
+	payouts     map[int64]float64     // Key is the payout time, kept across refreshes and loaded from the DB
+	snapshots   []poolBalanceSnapshot // Oldest first
+}
+
+var poolProviderFactories = make(map[string]poolProviderFactory)
+
+// Providers enabled in the config, key is the provider name
+var poolProviders = make(map[string]poolProvider)
+
+// Key is the provider name, then a receiving addr
+var poolCoins = make(map[string]map[string]poolInfoForAddr)
+
+// Addresses the pool poller refreshes, value is the last time the address was requested.
+// Addresses from PoolAddresses in the config are never dropped.
+var poolAddrs = make(map[string]int64)
+
+// Wakes the pool poller early when a new address is requested
+var poolPollNow = make(chan struct{}, 1)
+
+// Requested addresses are polled for this long after their last request
+const poolAddrIdleSeconds = 24 * 3600
+
+// Minimum time between attempts for one provider and address, so failing pools aren't hammered
+const poolRetrySeconds = 60
+
+type PoolAddrStatus struct {
+	Provider           string
+	Addr               string
+	LastUpdate         int64
+	SecondsSinceUpdate int64
+	Stale              bool
+	LastError          string
+}
+
+// Make a pool provider available to the config under name
+func registerPoolProvider(name string, factory poolProviderFactory) {
+	if _, ok := poolProviderFactories[name]; ok {
+		panic(fmt.Sprintf("pool provider %s registered twice", name))
+	}
+	poolProviderFactories[name] = factory
+}
+
+// Create the providers listed under Pools in the config. POGO is used when no pools are configured.
+func initPoolProviders() {
+	poolConfs := c.Pools
+	if poolConfs == nil {
+		poolConfs = map[string]poolConf{"pogo": {}}
+	}
+
+	for name, thisPoolConf := range poolConfs {
+		if thisPoolConf.Disabled {
+			continue
+		}
+		factory, ok := poolProviderFactories[name]
+		if !ok {
+			logger.fatal("unknown pool provider in config", "provider", name)
+		}
+		poolProviders[name] = factory(thisPoolConf.BaseURL)
+		poolCoins[name] = make(map[string]poolInfoForAddr)
+		logger.info("pool provider enabled", "provider", name)
+	}
+}
+
+// Provider names in a stable order
+func getPoolProviderNames() []string {
+	var names []string
+	for name := range poolProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Add addresses to the set the pool poller keeps fresh
+func subscribePoolAddrs(addrs []string) {
+	now := time.Now().Unix()
+	newAddr := false
+	mutex.Lock()
+	for _, addr := range addrs {
+		if len(addr) == 0 {
+			continue
+		}
+		if _, ok := poolAddrs[addr]; !ok {
+			newAddr = true
+		}
+		poolAddrs[addr] = now
+	}
+	mutex.Unlock()
+
+	if newAddr {
+		select {
+		case poolPollNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Pool data is stale once the pool has had a chance to publish data for a new hour, or after 10 minutes
+func isPoolInfoStale(thisPoolInfo poolInfoForAddr, now int64) bool {
+	startEpoch := getHourStart(0, time.UTC) + 60 // Wait 1 minute past the hour to get new data from the pool...
+	return thisPoolInfo.lastUpdate <= startEpoch || (now-thisPoolInfo.lastUpdate) >= 600
+}
+
+// Refresh stale pool data for every known address in the background so requests never wait on a pool
+func runPoolPoller(ctx context.Context) {
+	mutex.Lock()
+	for _, addr := range c.PoolAddresses {
+		poolAddrs[addr] = 0
+	}
+	mutex.Unlock()
+
+	for {
+		pollPools(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-poolPollNow:
+		case <-time.After(60 * time.Second):
+		}
+	}
+}
+
+func pollPools(ctx context.Context) {
+	type poolRefresh struct {
+		name string
+		addr string
+	}
+
+	var refreshes []poolRefresh
+	now := time.Now().Unix()
+	mutex.Lock()
+	for addr, lastRequested := range poolAddrs {
+		if lastRequested > 0 && now-lastRequested > poolAddrIdleSeconds && !contains(c.PoolAddresses, addr) {
+			delete(poolAddrs, addr)
+			continue
+		}
+		for name := range poolProviders {
+			thisPoolInfo := poolCoins[name][addr]
+			if isPoolInfoStale(thisPoolInfo, now) && now-thisPoolInfo.lastAttempt >= poolRetrySeconds {
+				refreshes = append(refreshes, poolRefresh{name: name, addr: addr})
+			}
+		}
+	}
+	mutex.Unlock()
+
+	for _, refresh := range refreshes {
+		if ctx.Err() != nil {
+			return
+		}
+		refreshPoolInfoForAddr(refresh.name, refresh.addr)
+	}
+}
+
+// Make RPC to the pool and update poolCoins. The mutex is not held during the request.
+func refreshPoolInfoForAddr(name string, addr string) {
+	logger.debug("refreshing pool data", "provider", name, "addr", addr)
+	curEpoch := time.Now().Unix()
+	mutex.Lock()
+	thisPoolInfo := getOrCreatePoolInfoForAddr(name, addr)
+	thisPoolInfo.lastAttempt = curEpoch
+	poolCoins[name][addr] = thisPoolInfo
+	mutex.Unlock()
+
+	addrInfo, err := poolProviders[name].getAddrInfo(addr)
+	if err != nil {
+		logger.warn("unable to get pool data", "provider", name, "addr", addr, "error", err)
+		poolFetches.inc(name, "error")
+		mutex.Lock()
+		thisPoolInfo = poolCoins[name][addr]
+		thisPoolInfo.lastError = err.Error()
+		poolCoins[name][addr] = thisPoolInfo
+		mutex.Unlock()
+		return
+	}
+
+	poolFetches.inc(name, "success")
+	snapshot := poolBalanceSnapshot{Epoch: curEpoch, Unpaid: addrInfo.UnpaidBalance}
+	storePoolPayouts(name, addr, addrInfo.Payouts)
+	storePoolBalanceSnapshot(name, addr, snapshot)
+
+	mutex.Lock()
+	addPoolBalanceSnapshot(name, addr, snapshot)
+	thisPoolInfo = poolCoins[name][addr]
+	for _, payout := range addrInfo.Payouts {
+		thisPoolInfo.payouts[payout.CreatedAt] = payout.Coins
+	}
+	thisPoolInfo.lastUpdate = curEpoch
+	thisPoolInfo.lastError = ""
+	poolCoins[name][addr] = thisPoolInfo
+	mutex.Unlock()
+}
+
+// Get how fresh the cached pool data is for each provider and address
+func getPoolAddrStatus(addrs []string) []PoolAddrStatus {
+	var statuses []PoolAddrStatus
+	now := time.Now().Unix()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, name := range getPoolProviderNames() {
+		for _, addr := range addrs {
+			if len(addr) == 0 {
+				continue
+			}
+			thisPoolInfo := poolCoins[name][addr]
+			thisStatus := PoolAddrStatus{
+				Provider:   name,
+				Addr:       addr,
+				LastUpdate: thisPoolInfo.lastUpdate,
+				Stale:      isPoolInfoStale(thisPoolInfo, now),
+				LastError:  thisPoolInfo.lastError,
+			}
+			if thisPoolInfo.lastUpdate > 0 {
+				thisStatus.SecondsSinceUpdate = now - thisPoolInfo.lastUpdate
+			}
+			statuses = append(statuses, thisStatus)
+		}
+	}
+
+	return statuses
+}
+
+// Caller must hold the mutex
+func getOrCreatePoolInfoForAddr(name string, addr string) poolInfoForAddr {
+	thisPoolInfo, ok := poolCoins[name][addr]
+	if !ok {
+		thisPoolInfo.payouts = make(map[int64]float64)
+	}
+	return thisPoolInfo
+}
+
+// Store payouts in the DB in one statement, payouts we already have are ignored
+func storePoolPayouts(name string, addr string, payouts []poolPayout) {
+	if len(payouts) == 0 {
+		return
+	}
+	var args []interface{}
+	for _, payout := range payouts {
+		args = append(args, name, addr, payout.CreatedAt, payout.Coins)
+	}
+	_, err := db.Exec("INSERT IGNORE INTO pool_payouts (provider, address, created_at, coins) VALUES (?, ?, ?, ?)"+
+		strings.Repeat(", (?, ?, ?, ?)", len(payouts)-1), args...)
+	if err != nil {
+		logger.error("unable to store pool payouts", "provider", name, "addr", addr, "error", err)
+	}
+}
+
+// Load stored payouts for the enabled pool providers so history survives restarts and payouts
+// that are no longer recent at the pool. Only payouts after the last snapshot before the memory
+// retention are loaded, or from the retention start without one, as prunePoolMemory keeps.
+func loadPoolPayoutsToMemory() {
+	retentionStart := getMemoryRetentionStart()
+	results, err := db.Query(`
+		select provider, address, created_at, coins from pool_payouts o
+		where created_at >= coalesce((select max(epoch) + 1 from pool_balances p
+			where p.provider = o.provider and p.address = o.address and p.epoch < ?), ?)`, retentionStart, retentionStart)
+	if err != nil {
+		panic(err.Error())
+	}
+	defer results.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for results.Next() {
+		var name, addr string
+		var payout poolPayout
+		err = results.Scan(&name, &addr, &payout.CreatedAt, &payout.Coins)
+		if err != nil {
+			panic(err.Error())
+		}
+		if _, ok := poolProviders[name]; !ok {
+			continue
+		}
+		thisPoolInfo := getOrCreatePoolInfoForAddr(name, addr)
+		thisPoolInfo.payouts[payout.CreatedAt] = payout.Coins
+		poolCoins[name][addr] = thisPoolInfo
+	}
+}
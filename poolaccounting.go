@@ -0,0 +1,160 @@
+package main
+
+import (
+	"sort"
+)
+
+// Unpaid balance reported by a pool at a point in time
+type poolBalanceSnapshot struct {
+	Epoch  int64
+	Unpaid float64
+}
+
+// Payouts are shifted back by this much so they fall into the hour they were paid FOR
+const poolPayoutShiftSeconds = 60
+
+// Call fn with pool earnings for an address that fall in the epoch range.
+//
+// Earnings between two balance snapshots are the change in unpaid balance plus anything paid out
+// in between, spread evenly over the time between the snapshots. A payout that hasn't shown up yet
+// makes the balance drop, those intervals count as nothing until the payout appears and they are
+// reconciled. Before the first snapshot we have no balances, so payouts count as earned in the
+// hour before they were made, and the balance at the first snapshot counts as earned just before it.
+// Caller must hold the mutex.
+func forEachPoolEarningInEpochRange(thisPoolInfo poolInfoForAddr, startEpoch int64, endEpoch int64, fn func(epoch int64, coins float64)) {
+	payoutTimes := make([]int64, 0, len(thisPoolInfo.payouts))
+	for createdAt := range thisPoolInfo.payouts {
+		payoutTimes = append(payoutTimes, createdAt)
+	}
+	sort.Slice(payoutTimes, func(i, j int) bool { return payoutTimes[i] < payoutTimes[j] })
+
+	snapshots := thisPoolInfo.snapshots
+	firstSnapshot := int64(-1)
+	if len(snapshots) > 0 {
+		firstSnapshot = snapshots[0].Epoch
+	}
+
+	// Payouts from before we started tracking balances
+	nextPayout := 0
+	for ; nextPayout < len(payoutTimes); nextPayout++ {
+		createdAt := payoutTimes[nextPayout]
+		if firstSnapshot >= 0 && createdAt > firstSnapshot {
+			break
+		}
+		earnedAt := createdAt - poolPayoutShiftSeconds
+		if startEpoch <= earnedAt && earnedAt < endEpoch {
+			fn(earnedAt, thisPoolInfo.payouts[createdAt])
+		}
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+
+	earnedAt := firstSnapshot - poolPayoutShiftSeconds
+	if startEpoch <= earnedAt && earnedAt < endEpoch {
+		fn(earnedAt, snapshots[0].Unpaid)
+	}
+
+	for i := 1; i < len(snapshots); i++ {
+		prev := snapshots[i-1]
+		cur := snapshots[i]
+
+		paidOut := 0.0
+		for ; nextPayout < len(payoutTimes) && payoutTimes[nextPayout] <= cur.Epoch; nextPayout++ {
+			paidOut += thisPoolInfo.payouts[payoutTimes[nextPayout]]
+		}
+
+		accrued := cur.Unpaid - prev.Unpaid + paidOut
+		if accrued <= 0 || cur.Epoch <= prev.Epoch {
+			continue
+		}
+
+		overlapStart := prev.Epoch
+		if startEpoch > overlapStart {
+			overlapStart = startEpoch
+		}
+		overlapEnd := cur.Epoch
+		if endEpoch < overlapEnd {
+			overlapEnd = endEpoch
+		}
+		if overlapStart >= overlapEnd {
+			continue
+		}
+		share := float64(overlapEnd-overlapStart) / float64(cur.Epoch-prev.Epoch)
+		fn(overlapStart+(overlapEnd-overlapStart)/2, accrued*share)
+	}
+}
+
+// Record the unpaid balance for an address at a refresh. Caller must hold the mutex.
+func addPoolBalanceSnapshot(name string, addr string, snapshot poolBalanceSnapshot) {
+	thisPoolInfo := getOrCreatePoolInfoForAddr(name, addr)
+	thisPoolInfo.snapshots = append(thisPoolInfo.snapshots, snapshot)
+	poolCoins[name][addr] = thisPoolInfo
+}
+
+// Drop pool data memory no longer needs. The last snapshot before cutoff is kept so the interval
+// running over the cutoff is still attributed, payouts up to it only ever count before it. Caller
+// must hold the mutex.
+func prunePoolMemory(cutoff int64) int {
+	pruned := 0
+	for name, addrPoolCoins := range poolCoins {
+		for addr, thisPoolInfo := range addrPoolCoins {
+			payoutCutoff := cutoff
+			keep := sort.Search(len(thisPoolInfo.snapshots), func(i int) bool {
+				return thisPoolInfo.snapshots[i].Epoch >= cutoff
+			}) - 1
+			if keep > 0 {
+				pruned += keep
+				thisPoolInfo.snapshots = append([]poolBalanceSnapshot(nil), thisPoolInfo.snapshots[keep:]...)
+			}
+			if len(thisPoolInfo.snapshots) > 0 && thisPoolInfo.snapshots[0].Epoch < cutoff {
+				payoutCutoff = thisPoolInfo.snapshots[0].Epoch + 1
+			}
+			for createdAt := range thisPoolInfo.payouts {
+				if createdAt < payoutCutoff {
+					delete(thisPoolInfo.payouts, createdAt)
+					pruned++
+				}
+			}
+			poolCoins[name][addr] = thisPoolInfo
+		}
+	}
+	return pruned
+}
+
+func storePoolBalanceSnapshot(name string, addr string, snapshot poolBalanceSnapshot) {
+	_, err := db.Exec(`
+		INSERT IGNORE INTO pool_balances (provider, address, epoch, unpaid) VALUES (?, ?, ?, ?)`,
+		name, addr, snapshot.Epoch, snapshot.Unpaid)
+	if err != nil {
+		logger.error("unable to store pool balance", "provider", name, "addr", addr, "error", err)
+	}
+}
+
+func loadPoolBalancesToMemory() {
+	// From the last snapshot before the memory retention, as prunePoolMemory keeps
+	results, err := db.Query(`
+		select provider, address, epoch, unpaid from pool_balances b
+		where epoch >= coalesce((select max(epoch) from pool_balances p
+			where p.provider = b.provider and p.address = b.address and p.epoch < ?), 0)
+		order by epoch asc`, getMemoryRetentionStart())
+	if err != nil {
+		panic(err.Error())
+	}
+	defer results.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for results.Next() {
+		var name, addr string
+		var snapshot poolBalanceSnapshot
+		err = results.Scan(&name, &addr, &snapshot.Epoch, &snapshot.Unpaid)
+		if err != nil {
+			panic(err.Error())
+		}
+		if _, ok := poolProviders[name]; !ok {
+			continue
+		}
+		addPoolBalanceSnapshot(name, addr, snapshot)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+type poolEarning struct {
+	epoch int64
+	coins float64
+}
+
+func collectPoolEarnings(thisPoolInfo poolInfoForAddr, startEpoch int64, endEpoch int64) (float64, []poolEarning) {
+	total := 0.0
+	var earnings []poolEarning
+	forEachPoolEarningInEpochRange(thisPoolInfo, startEpoch, endEpoch, func(epoch int64, coins float64) {
+		total += coins
+		earnings = append(earnings, poolEarning{epoch: epoch, coins: coins})
+	})
+	return total, earnings
+}
+
+func TestForEachPoolEarningInEpochRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshots []poolBalanceSnapshot
+		payouts   map[int64]float64
+		start     int64
+		end       int64
+		want      float64
+	}{
+		{
+			name:      "payout before the first snapshot counts in the minute before it was paid",
+			snapshots: []poolBalanceSnapshot{{Epoch: 2000, Unpaid: 1}},
+			payouts:   map[int64]float64{1000: 5},
+			start:     900,
+			end:       1000,
+			want:      5,
+		},
+		{
+			name:      "payout before the first snapshot is not counted after it was paid",
+			snapshots: []poolBalanceSnapshot{{Epoch: 2000, Unpaid: 1}},
+			payouts:   map[int64]float64{1000: 5},
+			start:     1000,
+			end:       1900,
+			want:      0,
+		},
+		{
+			name:      "first snapshot balance counts just before it",
+			snapshots: []poolBalanceSnapshot{{Epoch: 2000, Unpaid: 1}},
+			payouts:   map[int64]float64{1000: 5},
+			start:     0,
+			end:       3000,
+			want:      6,
+		},
+		{
+			name:      "payouts only",
+			snapshots: nil,
+			payouts:   map[int64]float64{1000: 5, 5000: 2},
+			start:     0,
+			end:       3000,
+			want:      5,
+		},
+		{
+			name:      "balance dropping before the payout is reported counts nothing",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}, {Epoch: 200, Unpaid: 0}},
+			payouts:   map[int64]float64{},
+			start:     100,
+			end:       200,
+			want:      0,
+		},
+		{
+			name:      "balance dropping before the payout is reported keeps earlier earnings",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}, {Epoch: 200, Unpaid: 0}},
+			payouts:   map[int64]float64{},
+			start:     0,
+			end:       300,
+			want:      10,
+		},
+		{
+			name:      "reconciled payout is not counted twice",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}, {Epoch: 200, Unpaid: 0}},
+			payouts:   map[int64]float64{150: 10},
+			start:     0,
+			end:       300,
+			want:      10,
+		},
+		{
+			name:      "reconciled payout with earnings after it",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}, {Epoch: 200, Unpaid: 0}, {Epoch: 300, Unpaid: 4}},
+			payouts:   map[int64]float64{150: 10},
+			start:     0,
+			end:       300,
+			want:      14,
+		},
+		{
+			name:      "payout between snapshots adds to the interval it was paid in",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 8}, {Epoch: 200, Unpaid: 3}},
+			payouts:   map[int64]float64{200: 10},
+			start:     100,
+			end:       200,
+			want:      5,
+		},
+		{
+			name:      "interval split at a bucket edge, first half",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}},
+			start:     0,
+			end:       50,
+			want:      5,
+		},
+		{
+			name:      "interval split at a bucket edge, second half",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}},
+			start:     50,
+			end:       100,
+			want:      5,
+		},
+		{
+			name:      "bucket inside an interval",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}},
+			start:     25,
+			end:       35,
+			want:      1,
+		},
+		{
+			name:      "bucket covering several intervals",
+			snapshots: []poolBalanceSnapshot{{Epoch: 0, Unpaid: 0}, {Epoch: 100, Unpaid: 10}, {Epoch: 200, Unpaid: 30}, {Epoch: 300, Unpaid: 40}},
+			start:     50,
+			end:       250,
+			want:      5 + 20 + 5,
+		},
+	}
+	for _, test := range tests {
+		payouts := test.payouts
+		if payouts == nil {
+			payouts = map[int64]float64{}
+		}
+		thisPoolInfo := poolInfoForAddr{snapshots: test.snapshots, payouts: payouts}
+		got, _ := collectPoolEarnings(thisPoolInfo, test.start, test.end)
+		if math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("%s: got %v coins, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Splitting a range into buckets must add up to the same coins as the whole range
+func TestPoolEarningsAddUpAcrossBuckets(t *testing.T) {
+	thisPoolInfo := poolInfoForAddr{
+		snapshots: []poolBalanceSnapshot{{Epoch: 500, Unpaid: 2}, {Epoch: 1100, Unpaid: 7}, {Epoch: 1700, Unpaid: 1}, {Epoch: 2900, Unpaid: 6}},
+		payouts:   map[int64]float64{300: 4, 1500: 9},
+	}
+	whole, _ := collectPoolEarnings(thisPoolInfo, 0, 3600)
+	split := 0.0
+	for start := int64(0); start < 3600; start += 360 {
+		coins, earnings := collectPoolEarnings(thisPoolInfo, start, start+360)
+		for _, earning := range earnings {
+			if earning.epoch < start || earning.epoch >= start+360 {
+				t.Errorf("earning at %d reported for bucket starting %d", earning.epoch, start)
+			}
+		}
+		split += coins
+	}
+	if math.Abs(whole-split) > 1e-9 {
+		t.Errorf("buckets add up to %v, the whole range is %v", split, whole)
+	}
+	// 4 before the first snapshot, 2 at it, then 5, 3 (after the 9 payout) and 5
+	if math.Abs(whole-19) > 1e-9 {
+		t.Errorf("whole range is %v, want 19", whole)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type pricePoint struct {
+	Epoch int64
+	Fiat  float64
+	BTC   float64
+}
+
+// A source for the current price of DMO. Prices are polled and stored so coins can be
+// valued at the time they were mined.
+type priceProvider interface {
+	getCurrentPrice() (pricePoint, error)
+}
+
+// Nil when no price provider is configured
+var prices priceProvider
+
+// Sorted by epoch, oldest first
+var priceHistory []pricePoint
+
+// Gets prices from an endpoint returning a flat json object keyed by currency, like:
+// {"usd": 0.0123, "btc": 0.00000031}
+type httpJSONPriceProvider struct {
+	url          string
+	fiatCurrency string
+	client       *http.Client
+}
+
+func newHTTPJSONPriceProvider(url string, fiatCurrency string) *httpJSONPriceProvider {
+	return &httpJSONPriceProvider{
+		url:          url,
+		fiatCurrency: strings.ToLower(fiatCurrency),
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (p *httpJSONPriceProvider) getCurrentPrice() (pricePoint, error) {
+	var thisPrice pricePoint
+
+	resp, err := p.client.Get(p.url)
+	if err != nil {
+		return thisPrice, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return thisPrice, fmt.Errorf("price endpoint returned status %d", resp.StatusCode)
+	}
+	bodyText, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return thisPrice, err
+	}
+
+	var pricesByCurrency map[string]float64
+	if err := json.Unmarshal(bodyText, &pricesByCurrency); err != nil {
+		return thisPrice, err
+	}
+
+	fiat, ok := pricesByCurrency[p.fiatCurrency]
+	if !ok {
+		return thisPrice, fmt.Errorf("price endpoint response has no %q price", p.fiatCurrency)
+	}
+	thisPrice.Epoch = time.Now().Unix()
+	thisPrice.Fiat = fiat
+	thisPrice.BTC = pricesByCurrency["btc"]
+
+	return thisPrice, nil
+}
+
+func getFiatCurrency() string {
+	if c.PriceFiatCurrency == "" {
+		return "usd"
+	}
+	return strings.ToLower(c.PriceFiatCurrency)
+}
+
+func initPriceProvider() {
+	if c.PriceURL == "" {
+		return
+	}
+	prices = newHTTPJSONPriceProvider(c.PriceURL, getFiatCurrency())
+}
+
+func loadPricesToMemory() {
+	// From the last price before the memory retention, as prunePriceHistory keeps
+	results, err := db.Query(`
+		select epoch, fiat, btc from prices where currency = ? and epoch >= coalesce((select max(epoch) from prices
+			where currency = ? and epoch < ?), 0)
+		order by epoch asc`, getFiatCurrency(), getFiatCurrency(), getMemoryRetentionStart())
+	if err != nil {
+		panic(err.Error())
+	}
+	defer results.Close()
+
+	var loadedPrices []pricePoint
+	for results.Next() {
+		var thisPrice pricePoint
+		err = results.Scan(&thisPrice.Epoch, &thisPrice.Fiat, &thisPrice.BTC)
+		if err != nil {
+			panic(err.Error())
+		}
+		loadedPrices = append(loadedPrices, thisPrice)
+	}
+
+	mutex.Lock()
+	priceHistory = loadedPrices
+	mutex.Unlock()
+}
+
+// Get the current price from the provider and store it in the DB and memory
+func recordCurrentPrice() {
+	thisPrice, err := prices.getCurrentPrice()
+	if err != nil {
+		logger.warn("unable to get current price", "error", err)
+		return
+	}
+
+	_, err = db.Exec("INSERT INTO prices (epoch, currency, fiat, btc) VALUES (?, ?, ?, ?)",
+		thisPrice.Epoch, getFiatCurrency(), thisPrice.Fiat, thisPrice.BTC)
+	if err != nil {
+		logger.error("unable to store price", "error", err)
+		return
+	}
+
+	mutex.Lock()
+	priceHistory = append(priceHistory, thisPrice)
+	mutex.Unlock()
+}
+
+func runPriceUpdater(ctx context.Context) {
+	interval := time.Duration(c.PriceUpdateMinutes) * time.Minute
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	for {
+		recordCurrentPrice()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Drop prices older than cutoff, keeping the one in effect at cutoff. Caller must hold the mutex.
+func prunePriceHistory(cutoff int64) int {
+	keep := sort.Search(len(priceHistory), func(i int) bool {
+		return priceHistory[i].Epoch >= cutoff
+	}) - 1
+	if keep <= 0 {
+		return 0
+	}
+	priceHistory = append([]pricePoint(nil), priceHistory[keep:]...)
+	return keep
+}
+
+// Get the most recent price at or before epoch. Caller must hold the mutex.
+func getPriceAtEpoch(epoch int64) (pricePoint, bool) {
+	return findPriceAtEpoch(priceHistory, epoch)
+}
+
+// Get the most recent price at or before epoch from prices sorted oldest first
+func findPriceAtEpoch(history []pricePoint, epoch int64) (pricePoint, bool) {
+	index := sort.Search(len(history), func(i int) bool {
+		return history[i].Epoch > epoch
+	})
+	if index == 0 {
+		return pricePoint{}, false
+	}
+	return history[index-1], true
+}
+
+// Read the stored prices needed to value coins between start and end, from the last price at or
+// before start. Reaches past the memory retention, for history.
+func loadPriceHistory(start int64, end int64) ([]pricePoint, error) {
+	results, err := db.Query(`
+		select epoch, fiat, btc from prices where currency = ? and epoch < ? and epoch >= coalesce((select max(epoch) from prices
+			where currency = ? and epoch <= ?), 0)
+		order by epoch asc`, getFiatCurrency(), end, getFiatCurrency(), start)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var loadedPrices []pricePoint
+	for results.Next() {
+		var thisPrice pricePoint
+		if err = results.Scan(&thisPrice.Epoch, &thisPrice.Fiat, &thisPrice.BTC); err != nil {
+			return nil, err
+		}
+		loadedPrices = append(loadedPrices, thisPrice)
+	}
+	return loadedPrices, results.Err()
+}
+
+// Get the fiat and BTC value of coins in an epoch range at the price when they were mined.
+// Coins mined before the first recorded price are not valued.
+func getValueInEpochRange(startEpoch int64, endEpoch int64, addresses string) (float64, float64) {
+	fiatValue := 0.0
+	btcValue := 0.0
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(priceHistory) == 0 {
+		return fiatValue, btcValue
+	}
+
+	forEachCoinsInEpochRange(startEpoch, endEpoch, addresses, func(epoch int64, coins float64, provider string) {
+		if thisPrice, ok := getPriceAtEpoch(epoch); ok {
+			fiatValue += coins * thisPrice.Fiat
+			btcValue += coins * thisPrice.BTC
+		}
+	})
+
+	return fiatValue, btcValue
+}
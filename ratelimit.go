@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultMaxAddresses = 10
+const defaultMaxRequestBytes = 64 * 1024
+
+// Buckets that have been full this long are dropped
+const rateLimitIdleTime = 10 * time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Token bucket rate limiter keyed by client
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // Tokens added per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+var ipLimiter *rateLimiter
+var keyLimiter *rateLimiter
+
+func newRateLimiter(perMinute int, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &rateLimiter{
+		rate:      float64(perMinute) / 60.0,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take a token for key. When none are left, returns how long until one will be.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	return l.allowAt(key, time.Now())
+}
+
+func (l *rateLimiter) allowAt(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitIdleTime {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Drop buckets that have refilled completely, caller must hold l.mu
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.last) > rateLimitIdleTime && bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func initRateLimiters() {
+	ipLimiter = newRateLimiter(c.RateLimitPerIP, c.RateLimitPerIPBurst)
+	keyLimiter = newRateLimiter(c.RateLimitPerKey, c.RateLimitPerKeyBurst)
+}
+
+func getMaxAddresses() int {
+	if c.MaxAddresses > 0 {
+		return c.MaxAddresses
+	}
+	return defaultMaxAddresses
+}
+
+func getMaxRequestBytes() int64 {
+	if c.MaxRequestBytes > 0 {
+		return c.MaxRequestBytes
+	}
+	return defaultMaxRequestBytes
+}
+
+// Whole seconds to wait, rounded up so retrying then always gets a token
+func retryAfterSeconds(wait time.Duration) int {
+	return int(math.Ceil(wait.Seconds()))
+}
+
+func rejectRateLimited(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(wait)))
+	abortWithError(c, http.StatusTooManyRequests, errCodeRateLimited, "rate limit exceeded")
+}
+
+// Middleware limiting requests per client IP, comes before apiKeyAuth so requests with missing or
+// wrong keys are limited too
+func ipRateLimit(c *gin.Context) {
+	if ipLimiter != nil {
+		if ok, wait := ipLimiter.allow(c.ClientIP()); !ok {
+			rejectRateLimited(c, wait)
+			return
+		}
+	}
+	c.Next()
+}
+
+// Middleware limiting requests per API key, must come after apiKeyAuth
+func keyRateLimit(c *gin.Context) {
+	if thisKey := getContextAPIKey(c); keyLimiter != nil && thisKey != nil {
+		if ok, wait := keyLimiter.allow(thisKey.Name); !ok {
+			rejectRateLimited(c, wait)
+			return
+		}
+	}
+	c.Next()
+}
+
+// Middleware capping the size of request bodies
+func limitRequestSize(c *gin.Context) {
+	maxBytes := getMaxRequestBytes()
+	if c.Request.ContentLength > maxBytes {
+		abortWithError(c, http.StatusRequestEntityTooLarge, errCodeRequestTooLarge, "request body too large")
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	c.Next()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	if newRateLimiter(0, 5) != nil {
+		t.Error("a zero rate should disable the limiter")
+	}
+	if limiter := newRateLimiter(30, 0); limiter.burst != 30 || limiter.rate != 0.5 {
+		t.Errorf("got burst %v and rate %v, want 30 and 0.5", limiter.burst, limiter.rate)
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	start := time.Now()
+	type step struct {
+		key     string
+		after   time.Duration // Since start
+		allowed bool
+		wait    time.Duration
+	}
+	tests := []struct {
+		name      string
+		perMinute int
+		burst     int
+		steps     []step
+	}{
+		{
+			name:      "burst then refill",
+			perMinute: 60,
+			burst:     2,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second},
+				{"a", 500 * time.Millisecond, false, 500 * time.Millisecond},
+				{"a", time.Second, true, 0},
+				{"a", time.Second, false, time.Second},
+			},
+		},
+		{
+			name:      "keys have their own buckets",
+			perMinute: 60,
+			burst:     1,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second},
+				{"b", 0, true, 0},
+			},
+		},
+		{
+			name:      "refill is capped at the burst",
+			perMinute: 60,
+			burst:     2,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", time.Hour, true, 0},
+				{"a", time.Hour, true, 0},
+				{"a", time.Hour, false, time.Second},
+			},
+		},
+		{
+			name:      "fractional wait",
+			perMinute: 90,
+			burst:     1,
+			steps: []step{
+				{"a", 0, true, 0},
+				{"a", 0, false, time.Second * 2 / 3},
+			},
+		},
+	}
+	for _, test := range tests {
+		limiter := newRateLimiter(test.perMinute, test.burst)
+		for i, step := range test.steps {
+			allowed, wait := limiter.allowAt(step.key, start.Add(step.after))
+			if allowed != step.allowed {
+				t.Errorf("%s: step %d allowed %v, want %v", test.name, i, allowed, step.allowed)
+			}
+			if diff := wait - step.wait; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("%s: step %d wait %v, want %v", test.name, i, wait, step.wait)
+			}
+		}
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Nanosecond, 1},
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{time.Second + time.Millisecond, 2},
+		{90 * time.Second, 90},
+	}
+	for _, test := range tests {
+		if got := retryAfterSeconds(test.wait); got != test.want {
+			t.Errorf("retryAfterSeconds(%v) = %d, want %d", test.wait, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Stats requests go back at most 21 days, memory has to cover that
+const minMemoryRetentionDays = 22
+
+func getBlockHistoryDepth() int {
+	if c.BlockHistoryDepth <= 0 {
+		return 100000
+	}
+	return c.BlockHistoryDepth
+}
+
+func getMemoryRetentionDays() int {
+	if c.MemoryRetentionDays <= 0 {
+		return 30
+	}
+	if c.MemoryRetentionDays < minMemoryRetentionDays {
+		return minMemoryRetentionDays
+	}
+	return c.MemoryRetentionDays
+}
+
+// Zero when raw blocks are kept forever
+func getDBRetentionDays() int {
+	if c.DBRetentionDays <= 0 {
+		return 0
+	}
+	if c.DBRetentionDays < getMemoryRetentionDays() {
+		return getMemoryRetentionDays()
+	}
+	return c.DBRetentionDays
+}
+
+// Blocks older than this are dropped from memory
+func getMemoryRetentionStart() int64 {
+	return time.Now().Unix() - int64(getMemoryRetentionDays())*24*60*60
+}
+
+// Prune memory and compact the DB hourly
+func runRetention(ctx context.Context) {
+	for {
+		pruneMemory()
+		if err := compactOldBlocks(ctx); err != nil {
+			logger.error("unable to compact old blocks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
+
+// Drop blocks, pool data and prices older than the memory retention from memory
+func pruneMemory() {
+	cutoff := getMemoryRetentionStart()
+	pruned := 0
+
+	mutex.Lock()
+	start := lowestDBHeight
+	lowestDBHeight = currentDBHeight + 1 // In case every block is pruned
+	for i := start; i <= currentDBHeight; i++ {
+		block, ok := blockMap[i]
+		if !ok {
+			continue
+		}
+		if int64(block.Time) >= cutoff {
+			lowestDBHeight = i
+			break
+		}
+		delete(blockMap, i)
+		pruned++
+	}
+	lowest := lowestDBHeight
+	poolPruned := prunePoolMemory(cutoff)
+	pricesPruned := prunePriceHistory(cutoff)
+	mutex.Unlock()
+
+	if pruned > 0 || poolPruned > 0 || pricesPruned > 0 {
+		logger.info("pruned old data from memory", "blocks", pruned, "lowest_height", lowest, "pool_entries", poolPruned, "prices", pricesPruned)
+	}
+}
+
+// Heights compacted per transaction, so the tip sync isn't held up behind one huge delete
+const compactChunkHeights = 5000
+
+// Roll blocks older than the DB retention up into stats_hourly and delete them, a chunk of heights
+// per transaction so a block is always counted exactly once. The cutoff is on an hour boundary and
+// rollups are added to, so blocks backfilled into an already compacted hour are counted too.
+func compactOldBlocks(ctx context.Context) error {
+	retentionDays := getDBRetentionDays()
+	if retentionDays == 0 {
+		return nil
+	}
+	cutoff := time.Now().Unix() - int64(retentionDays)*24*60*60
+	cutoff -= cutoff % 3600
+
+	var total int64
+	for ctx.Err() == nil {
+		var lowest sql.NullInt64
+		if err := db.QueryRow("SELECT min(height_id) FROM stats WHERE epoch < ?", cutoff).Scan(&lowest); err != nil {
+			return err
+		}
+		if !lowest.Valid {
+			break
+		}
+		deleted, err := compactHeightChunk(int(lowest.Int64), int(lowest.Int64)+compactChunkHeights-1, cutoff)
+		if err != nil {
+			return err
+		}
+		total += deleted
+	}
+
+	if total > 0 {
+		logger.info("compacted old blocks into hourly rollups", "blocks", total, "before", cutoff)
+	}
+	return nil
+}
+
+// Compact the blocks between from and to that are older than cutoff, returns how many were deleted
+func compactHeightChunk(from int, to int, cutoff int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO stats_hourly (hour_epoch, miningaddr, blocks, coins)
+		SELECT epoch - epoch % 3600, coalesce(miningaddr, ''), count(*), coalesce(sum(coins), 0) FROM stats
+		WHERE height_id >= ? AND height_id <= ? AND epoch < ? GROUP BY epoch - epoch % 3600, coalesce(miningaddr, '')
+		ON DUPLICATE KEY UPDATE blocks = blocks + VALUES(blocks), coins = coins + VALUES(coins)`, from, to, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if err = recordCompactedHeights(tx, from, to, cutoff); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec("DELETE FROM stats WHERE height_id >= ? AND height_id <= ? AND epoch < ?", from, to, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Remember which heights of a chunk were compacted, so gap checks don't report them as missing.
+// A chunk without holes is one range from its min to its max, otherwise each run of heights is
+// recorded so the holes can still be backfilled.
+func recordCompactedHeights(tx *sql.Tx, from int, to int, cutoff int64) error {
+	var lowest, highest sql.NullInt64
+	var count int64
+	err := tx.QueryRow("SELECT min(height_id), max(height_id), count(*) FROM stats WHERE height_id >= ? AND height_id <= ? AND epoch < ?",
+		from, to, cutoff).Scan(&lowest, &highest, &count)
+	if err != nil || count == 0 {
+		return err
+	}
+
+	var ranges []HeightRangeV1
+	if highest.Int64-lowest.Int64+1 == count {
+		ranges = append(ranges, HeightRangeV1{From: int(lowest.Int64), To: int(highest.Int64)})
+	} else {
+		results, err := tx.Query("SELECT height_id FROM stats WHERE height_id >= ? AND height_id <= ? AND epoch < ? ORDER BY height_id", from, to, cutoff)
+		if err != nil {
+			return err
+		}
+		for results.Next() {
+			var height int
+			if err = results.Scan(&height); err != nil {
+				results.Close()
+				return err
+			}
+			if len(ranges) > 0 && ranges[len(ranges)-1].To == height-1 {
+				ranges[len(ranges)-1].To = height
+			} else {
+				ranges = append(ranges, HeightRangeV1{From: height, To: height})
+			}
+		}
+		results.Close()
+		if err = results.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, heightRange := range ranges {
+		_, err = tx.Exec(`INSERT INTO compacted_ranges (start_height, end_height) VALUES (?, ?)
+			ON DUPLICATE KEY UPDATE end_height = GREATEST(end_height, VALUES(end_height))`, heightRange.From, heightRange.To)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long in flight requests get to finish once a shutdown starts
+const shutdownTimeout = 30 * time.Second
+
+// Run a background loop until ctx is done. shutdown waits for it so nothing is using the DB when it closes.
+func runInBackground(ctx context.Context, background *sync.WaitGroup, loop func(context.Context)) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		loop(ctx)
+	}()
+}
+
+// Stop accepting requests, drain the ones in flight and wait for the background loops. The caller
+// closes the DB afterwards.
+func shutdown(server *http.Server, background *sync.WaitGroup) {
+	logger.info("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		logger.error("unable to drain http requests", "error", err)
+	}
+	background.Wait()
+	logger.info("shutdown complete")
+}
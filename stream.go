@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Events buffered per subscriber, events for a subscriber that falls this far behind are dropped
+const streamBufferSize = 256
+
+const streamPingInterval = 30 * time.Second
+
+type streamRequestV1 struct {
+	Addresses string `json:"addresses" form:"addresses"`
+	Group     string `json:"group" form:"group"`
+	APIKey    string `json:"api_key" form:"api_key"` // For browsers, which can't send the X-API-Key header
+}
+
+type BlockEventV1 struct {
+	Height  int     `json:"height"`
+	Hash    string  `json:"hash"`
+	Time    int     `json:"time"`
+	Miner   string  `json:"miner"`
+	Coins   float64 `json:"coins"`
+	Matched bool    `json:"matched"` // Mined by one of the subscribed addresses
+}
+
+// Sent after every sync with the node, covering the blocks ingested by that sync
+type StatsDeltaEventV1 struct {
+	FromHeight    int     `json:"from_height"`
+	ToHeight      int     `json:"to_height"`
+	NewBlocks     int     `json:"new_blocks"`
+	ChainCoins    float64 `json:"chain_coins"`
+	MatchedBlocks int     `json:"matched_blocks"`
+	MatchedCoins  float64 `json:"matched_coins"`
+	NetHash       float64 `json:"net_hash"`
+}
+
+// Message format for websocket clients, SSE clients get Event as the event name
+type StreamEventV1 struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+type streamSubscriber struct {
+	addrs  map[string]bool
+	events chan StreamEventV1
+}
+
+var streamSubscribers = make(map[*streamSubscriber]bool)
+var streamMutex = &sync.Mutex{}
+
+// Closed on shutdown to end every stream, http.Server.Shutdown would otherwise wait on them
+var streamsClosed = make(chan struct{})
+var closeStreamsOnce sync.Once
+
+func closeStreams() {
+	closeStreamsOnce.Do(func() { close(streamsClosed) })
+}
+
+var wsUpgrader = websocket.Upgrader{
+	// Dashboards are served from other origins, access is controlled by API keys instead
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func subscribeStream(addrs []string) *streamSubscriber {
+	subscriber := &streamSubscriber{
+		addrs:  make(map[string]bool),
+		events: make(chan StreamEventV1, streamBufferSize),
+	}
+	for _, addr := range addrs {
+		subscriber.addrs[addr] = true
+	}
+
+	streamMutex.Lock()
+	streamSubscribers[subscriber] = true
+	streamMutex.Unlock()
+	return subscriber
+}
+
+func unsubscribeStream(subscriber *streamSubscriber) {
+	streamMutex.Lock()
+	delete(streamSubscribers, subscriber)
+	streamMutex.Unlock()
+}
+
+func (s *streamSubscriber) send(event StreamEventV1) {
+	select {
+	case s.events <- event:
+	default:
+	}
+}
+
+// Push a newly ingested block to every subscriber
+func publishBlockEvent(block blockInformation) {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	for subscriber := range streamSubscribers {
+		subscriber.send(StreamEventV1{
+			Event: "block",
+			Data: BlockEventV1{
+				Height:  block.Height,
+				Hash:    block.Hash,
+				Time:    block.Time,
+				Miner:   block.Addr,
+				Coins:   block.Coins,
+				Matched: subscriber.addrs[block.Addr],
+			},
+		})
+	}
+}
+
+// Push what a sync added, summarized for each subscriber's addresses
+func publishStatsDelta(blocks []blockInformation) {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	for subscriber := range streamSubscribers {
+		delta := StatsDeltaEventV1{NewBlocks: len(blocks), NetHash: globalNetHash}
+		for i, block := range blocks {
+			if i == 0 || block.Height < delta.FromHeight {
+				delta.FromHeight = block.Height
+			}
+			if block.Height > delta.ToHeight {
+				delta.ToHeight = block.Height
+			}
+			delta.ChainCoins += block.Coins
+			if subscriber.addrs[block.Addr] {
+				delta.MatchedBlocks++
+				delta.MatchedCoins += block.Coins
+			}
+		}
+		subscriber.send(StreamEventV1{Event: "stats", Data: delta})
+	}
+}
+
+// Validate a stream request and subscribe it. On a bad request the error response has already
+// been sent and ok is false.
+func subscribeStreamRequest(c *gin.Context) (*streamSubscriber, bool) {
+	var request streamRequestV1
+	if err := c.ShouldBindQuery(&request); err != nil {
+		abortWithBindError(c, err)
+		return nil, false
+	}
+
+	if request.Group != "" {
+		addresses, err := getAddrGroupAddresses(request.Group)
+		if err != nil {
+			abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+			return nil, false
+		}
+		request.Addresses = addresses
+	}
+	addrs, err := parseAddresses(request.Addresses)
+	if err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeInvalidAddress, err.Error())
+		return nil, false
+	}
+	if len(addrs) > getMaxAddresses() {
+		abortWithError(c, http.StatusBadRequest, errCodeTooManyAddresses, fmt.Sprintf("at most %d addresses can be requested", getMaxAddresses()))
+		return nil, false
+	}
+	if !apiKeyAllows(c, request.Group, addrs) {
+		abortWithError(c, http.StatusForbidden, errCodeForbidden, "api key is not allowed to query these addresses")
+		return nil, false
+	}
+
+	return subscribeStream(addrs), true
+}
+
+func streamSSEV1RPC(c *gin.Context) {
+	subscriber, ok := subscribeStreamRequest(c)
+	if !ok {
+		return
+	}
+	defer unsubscribeStream(subscriber)
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-subscriber.events:
+			c.SSEvent(event.Event, event.Data)
+		case <-ping.C:
+			c.SSEvent("ping", time.Now().Unix())
+		case <-c.Request.Context().Done():
+			return false
+		case <-streamsClosed:
+			return false
+		}
+		return true
+	})
+}
+
+func streamWebSocketV1RPC(c *gin.Context) {
+	subscriber, ok := subscribeStreamRequest(c)
+	if !ok {
+		return
+	}
+	defer unsubscribeStream(subscriber)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already responded
+		return
+	}
+	defer conn.Close()
+
+	// Clients don't send us anything, but reading is needed to handle control frames and notice closes
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case event := <-subscriber.events:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-streamsClosed:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"), time.Now().Add(time.Second))
+			return
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Human readable part of DMO bech32 addresses
+const dmoBech32HRP = "dy"
+
+// Version bytes of DMO base58check pay to pubkey hash and pay to script hash addresses
+const (
+	dmoPubKeyHashVersion = 30
+	dmoScriptHashVersion = 90
+)
+
+// Error codes returned in the error envelope
+const (
+	errCodeBadRequest       = "bad_request"
+	errCodeInvalidAddress   = "invalid_address"
+	errCodeMissingAddresses = "missing_addresses"
+	errCodeTooManyAddresses = "too_many_addresses"
+	errCodeInvalidTimeZone  = "invalid_time_zone"
+	errCodeInvalidRange     = "invalid_range"
+	errCodeInvalidName      = "invalid_name"
+	errCodeNotFound         = "not_found"
+	errCodeUnauthorized     = "unauthorized"
+	errCodeForbidden        = "forbidden"
+	errCodeRateLimited      = "rate_limited"
+	errCodeRequestTooLarge  = "request_too_large"
+	errCodeInternal         = "internal_error"
+	errCodeUnavailable      = "unavailable"
+	errCodeConflict         = "conflict"
+)
+
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Every error response is {"error": {"code": "...", "message": "..."}}
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+func abortWithError(c *gin.Context, status int, code string, message string) {
+	c.AbortWithStatusJSON(status, APIErrorResponse{Error: APIError{Code: code, Message: message}})
+}
+
+// Stats requests are a json body for POST, and query parameters for GET. A GET with a json body
+// is still accepted for older clients.
+func bindStatsRequest(c *gin.Context, obj interface{}) error {
+	if c.Request.Method == http.MethodGet && c.Request.ContentLength == 0 {
+		return c.ShouldBindQuery(obj)
+	}
+	return c.ShouldBindJSON(obj)
+}
+
+// Report a failed bind, telling oversized bodies apart from malformed ones
+func abortWithBindError(c *gin.Context, err error) {
+	if strings.Contains(err.Error(), "request body too large") {
+		abortWithError(c, http.StatusRequestEntityTooLarge, errCodeRequestTooLarge, "request body too large")
+		return
+	}
+	abortWithError(c, http.StatusBadRequest, errCodeBadRequest, "invalid request: "+err.Error())
+}
+
+func notFoundRPC(c *gin.Context) {
+	abortWithError(c, http.StatusNotFound, errCodeNotFound, "no such endpoint")
+}
+
+// Load a request time zone, empty means UTC
+func parseTimeZone(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", timeZone)
+	}
+	return loc, nil
+}
+
+// The number of days may be 0 to 21, values below 2 are raised to 2
+func parseNumDays(numDays int) (int, error) {
+	if numDays < 0 || numDays > 21 {
+		return 0, fmt.Errorf("number of days must be between 0 and 21")
+	}
+	if numDays < 2 {
+		numDays = 2
+	}
+	return numDays, nil
+}
+
+// Split a comma separated address list, dropping empty entries and duplicates, and check each address
+func parseAddresses(addresses string) ([]string, error) {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, addr := range strings.Split(addresses, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" || seen[addr] {
+			continue
+		}
+		if err := validateDMOAddress(addr); err != nil {
+			return nil, fmt.Errorf("invalid address %q: %s", addr, err.Error())
+		}
+		addr = normalizeDMOAddress(addr)
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// Check an address is a DMO segwit (bech32/bech32m) address or a base58check address
+func validateDMOAddress(addr string) error {
+	if len(addr) > 64 {
+		return errors.New("too long")
+	}
+	if strings.HasPrefix(strings.ToLower(addr), dmoBech32HRP+"1") {
+		return validateBech32Address(addr)
+	}
+	return validateBase58Address(addr)
+}
+
+// Bech32 addresses may be written in upper case, the node reports them in lower case
+func normalizeDMOAddress(addr string) string {
+	if strings.HasPrefix(strings.ToLower(addr), dmoBech32HRP+"1") {
+		return strings.ToLower(addr)
+	}
+	return addr
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, value := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// Regroup bits, used to turn 5 bit bech32 words into witness program bytes
+func convertBits(data []byte, fromBits uint, toBits uint) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxValue := uint32(1)<<toBits - 1
+	var converted []byte
+	for _, value := range data {
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxValue))
+		}
+	}
+	if bits >= fromBits || (acc<<(toBits-bits))&maxValue != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return converted, nil
+}
+
+// Segwit address rules from BIP 173 and BIP 350
+func validateBech32Address(addr string) error {
+	if addr != strings.ToLower(addr) && addr != strings.ToUpper(addr) {
+		return errors.New("mixed case")
+	}
+	addr = strings.ToLower(addr)
+	separator := strings.LastIndexByte(addr, '1')
+	hrp := addr[:separator]
+	if hrp != dmoBech32HRP || len(addr)-separator-1 < 7 {
+		return errors.New("not a DMO address")
+	}
+
+	var words []byte
+	for _, char := range addr[separator+1:] {
+		index := strings.IndexRune(bech32Charset, char)
+		if index < 0 {
+			return errors.New("invalid character")
+		}
+		words = append(words, byte(index))
+	}
+
+	checksum := bech32Polymod(append(bech32HRPExpand(hrp), words...))
+	witnessVersion := words[0]
+	if (witnessVersion == 0 && checksum != bech32Const) || (witnessVersion != 0 && checksum != bech32mConst) {
+		return errors.New("bad checksum")
+	}
+	if witnessVersion > 16 {
+		return errors.New("invalid witness version")
+	}
+
+	program, err := convertBits(words[1:len(words)-6], 5, 8)
+	if err != nil {
+		return err
+	}
+	if len(program) < 2 || len(program) > 40 || (witnessVersion == 0 && len(program) != 20 && len(program) != 32) {
+		return errors.New("invalid witness program length")
+	}
+	return nil
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Legacy addresses are a DMO version byte and a 20 byte hash with a 4 byte double sha256 checksum
+func validateBase58Address(addr string) error {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, char := range addr {
+		index := strings.IndexRune(base58Alphabet, char)
+		if index < 0 {
+			return errors.New("invalid character")
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(index)))
+	}
+
+	decoded := value.Bytes()
+	for i := 0; i < len(addr) && addr[i] == '1'; i++ {
+		decoded = append([]byte{0}, decoded...)
+	}
+	if len(decoded) != 25 {
+		return errors.New("invalid length")
+	}
+
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	if string(second[:4]) != string(decoded[21:]) {
+		return errors.New("bad checksum")
+	}
+	if decoded[0] != dmoPubKeyHashVersion && decoded[0] != dmoScriptHashVersion {
+		return errors.New("not a DMO address")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValidateDMOAddress(t *testing.T) {
+	tests := []struct {
+		name  string
+		addr  string
+		valid bool
+	}{
+		{"bech32 from the getminingstats docs", "dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvm", true},
+		{"bech32 upper case", "DY1QPFR5YHDKGS6JYUK945Y23PSKDXMY9AJEFCZSVM", true},
+		{"bech32 mixed case", "dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvM", false},
+		{"bech32 bad checksum", "dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvn", false},
+		{"bech32 invalid character", "dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvb", false},
+		{"bech32 too short", "dy1qpfr5y", false},
+		{"bitcoin bech32", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", false},
+		{"base58 pubkey hash", "D5samrFD4hruxnCuQ7gzx1obwKp58fc5Ub", true},
+		{"base58 script hash", "dELPcFoymmPmojp3GVvNkF8hgy7EXqGXYC", true},
+		{"base58 bad checksum", "D5samrFD4hruxnCuQ7gzx1obwKp58fc5Uc", false},
+		{"base58 invalid character", "D5samrFD4hruxnCuQ7gzx1obwKp58fc5U0", false},
+		{"bitcoin genesis address", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", false},
+		{"bitcoin script hash", "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", false},
+		{"too long", "dy1q" + strings.Repeat("q", 61), false},
+		{"empty", "", false},
+	}
+	for _, test := range tests {
+		err := validateDMOAddress(test.addr)
+		if test.valid && err != nil {
+			t.Errorf("%s: %q should be valid, got %v", test.name, test.addr, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: %q should be invalid", test.name, test.addr)
+		}
+	}
+}
+
+// Vectors from BIP 173 and BIP 350
+func TestBech32Polymod(t *testing.T) {
+	tests := []struct {
+		str      string
+		checksum uint32
+	}{
+		{"a12uel5l", bech32Const},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", bech32Const},
+		{"a1lqfn3a", bech32mConst},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", bech32mConst},
+	}
+	for _, test := range tests {
+		separator := strings.LastIndexByte(test.str, '1')
+		var words []byte
+		for _, char := range test.str[separator+1:] {
+			words = append(words, byte(strings.IndexRune(bech32Charset, char)))
+		}
+		checksum := bech32Polymod(append(bech32HRPExpand(test.str[:separator]), words...))
+		if checksum != test.checksum {
+			t.Errorf("%s: checksum %#x, want %#x", test.str, checksum, test.checksum)
+		}
+	}
+}
+
+func TestConvertBits(t *testing.T) {
+	program := []byte{0x0a, 0x47, 0x42, 0x5d, 0xb6, 0x44, 0x35, 0x22, 0x72, 0xc5, 0xa2, 0xd0, 0x8a, 0x86, 0x16, 0x69, 0xb6, 0x42, 0xf6, 0x59}
+
+	// 8 to 5 bits pads the last word, so regroup by hand and check the round trip
+	var words []byte
+	acc, bits := uint32(0), uint(0)
+	for _, value := range program {
+		acc = acc<<8 | uint32(value)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			words = append(words, byte(acc>>bits&31))
+		}
+	}
+	if bits > 0 {
+		words = append(words, byte(acc<<(5-bits)&31))
+	}
+	converted, err := convertBits(words, 5, 8)
+	if err != nil || !bytes.Equal(converted, program) {
+		t.Errorf("round trip gave %x, %v, want %x", converted, err, program)
+	}
+
+	tests := []struct {
+		name  string
+		words []byte
+		valid bool
+	}{
+		{"zero padding", []byte{0, 0}, true},
+		{"non zero padding", []byte{0, 1}, false},
+		{"a whole word of padding", []byte{31}, false},
+	}
+	for _, test := range tests {
+		_, err := convertBits(test.words, 5, 8)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestParseAddressesLowercasesBech32(t *testing.T) {
+	addrs, err := parseAddresses("DY1QPFR5YHDKGS6JYUK945Y23PSKDXMY9AJEFCZSVM, dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvm,D5samrFD4hruxnCuQ7gzx1obwKp58fc5Ub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"dy1qpfr5yhdkgs6jyuk945y23pskdxmy9ajefczsvm", "D5samrFD4hruxnCuQ7gzx1obwKp58fc5Ub"}
+	if strings.Join(addrs, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", addrs, want)
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxWebhooksPerGroup = 5
+
+// Blocks older than this when they are ingested (a first sync or catching up after downtime)
+// don't notify, so webhooks aren't flooded with history
+const webhookMaxBlockAge = 24 * 60 * 60
+
+// Deliveries are retried with a doubling delay, starting at webhookRetryDelay and capped at
+// webhookMaxRetryDelay, and marked failed after webhookMaxAttempts
+const webhookRetryDelay = 30
+const webhookMaxRetryDelay = 6 * 60 * 60
+const webhookMaxAttempts = 12
+
+type GroupWebhook struct {
+	ID      int
+	Group   string
+	URL     string
+	Secret  string // Only returned when the webhook is created
+	Created int64
+}
+
+// Body POSTed to a group's webhooks when one of its addresses mines a block
+type BlockWebhookPayload struct {
+	Event   string  `json:"event"`
+	Group   string  `json:"group"`
+	Address string  `json:"address"`
+	Label   string  `json:"label"`
+	Height  int     `json:"height"`
+	Hash    string  `json:"hash"`
+	Time    int     `json:"time"`
+	Coins   float64 `json:"coins"`
+}
+
+// Key is the group name
+var groupWebhooks = make(map[string][]GroupWebhook)
+
+var webhookSendNow = make(chan struct{}, 1)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// Signature sent in the X-DMO-Signature header, an HMAC-SHA256 of the timestamp header, a "." and the body
+func signWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func loadGroupWebhooksToMemory() {
+	loadedWebhooks := make(map[string][]GroupWebhook)
+
+	results, err := db.Query("select id, group_name, url, secret, created from group_webhooks order by id")
+	if err != nil {
+		panic(err.Error())
+	}
+	defer results.Close()
+	for results.Next() {
+		var webhook GroupWebhook
+		if err = results.Scan(&webhook.ID, &webhook.Group, &webhook.URL, &webhook.Secret, &webhook.Created); err != nil {
+			panic(err.Error())
+		}
+		loadedWebhooks[webhook.Group] = append(loadedWebhooks[webhook.Group], webhook)
+	}
+
+	mutex.Lock()
+	groupWebhooks = loadedWebhooks
+	mutex.Unlock()
+}
+
+// Webhooks of a group without their secrets
+func listGroupWebhooks(name string) []GroupWebhook {
+	mutex.Lock()
+	defer mutex.Unlock()
+	webhooks := make([]GroupWebhook, 0, len(groupWebhooks[name]))
+	for _, webhook := range groupWebhooks[name] {
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
+
+func createGroupWebhook(name string, webhookURL string) (GroupWebhook, error) {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return GroupWebhook{}, err
+	}
+	webhook := GroupWebhook{Group: name, URL: webhookURL, Secret: secret, Created: time.Now().Unix()}
+
+	result, err := db.Exec("INSERT INTO group_webhooks (group_name, url, secret, created) VALUES (?, ?, ?, ?)",
+		webhook.Group, webhook.URL, webhook.Secret, webhook.Created)
+	if err != nil {
+		return webhook, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return webhook, err
+	}
+	webhook.ID = int(id)
+
+	mutex.Lock()
+	groupWebhooks[name] = append(groupWebhooks[name], webhook)
+	mutex.Unlock()
+	return webhook, nil
+}
+
+// Delete a webhook and anything still queued for it, false if the group has no such webhook
+func deleteGroupWebhook(name string, id int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM group_webhooks WHERE id = ? AND group_name = ?", id, name)
+	if err != nil {
+		return false, err
+	}
+	if deleted, err := result.RowsAffected(); err != nil || deleted == 0 {
+		return false, err
+	}
+	if _, err = tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+		return false, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+
+	mutex.Lock()
+	var kept []GroupWebhook
+	for _, webhook := range groupWebhooks[name] {
+		if webhook.ID != id {
+			kept = append(kept, webhook)
+		}
+	}
+	groupWebhooks[name] = kept
+	mutex.Unlock()
+	return true, nil
+}
+
+// Queue a delivery to every webhook of every group containing the block's miner. Called inside
+// the transaction storing the block, so a stored block always has its deliveries queued.
+func queueBlockWebhooks(tx *sql.Tx, block blockInformation) error {
+	if int64(block.Time) < time.Now().Unix()-webhookMaxBlockAge {
+		return nil
+	}
+
+	type delivery struct {
+		webhookID int
+		payload   BlockWebhookPayload
+	}
+	var deliveries []delivery
+	mutex.Lock()
+	for name, webhooks := range groupWebhooks {
+		if len(webhooks) == 0 {
+			continue
+		}
+		for _, member := range addrGroups[name].Members {
+			if member.Address != block.Addr {
+				continue
+			}
+			payload := BlockWebhookPayload{
+				Event:   "block",
+				Group:   name,
+				Address: block.Addr,
+				Label:   member.Label,
+				Height:  block.Height,
+				Hash:    block.Hash,
+				Time:    block.Time,
+				Coins:   block.Coins,
+			}
+			for _, webhook := range webhooks {
+				deliveries = append(deliveries, delivery{webhookID: webhook.ID, payload: payload})
+			}
+		}
+	}
+	mutex.Unlock()
+
+	now := time.Now().Unix()
+	for _, thisDelivery := range deliveries {
+		body, err := json.Marshal(thisDelivery.payload)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO webhook_deliveries (webhook_id, event, payload, next_attempt, created) VALUES (?, ?, ?, ?, ?)",
+			thisDelivery.webhookID, thisDelivery.payload.Event, string(body), now, now)
+		if err != nil {
+			return fmt.Errorf("queueing webhook %d: %w", thisDelivery.webhookID, err)
+		}
+	}
+	return nil
+}
+
+// Have the sender look at the queue now instead of at its next poll
+func wakeWebhookSender() {
+	select {
+	case webhookSendNow <- struct{}{}:
+	default:
+	}
+}
+
+// Send queued webhook deliveries in the background, retrying failures until they run out of attempts
+func runWebhookSender(ctx context.Context) {
+	for {
+		sendWebhookDeliveries(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-webhookSendNow:
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+// Send what is due, stopping between deliveries when ctx is done
+func sendWebhookDeliveries(ctx context.Context) {
+	type delivery struct {
+		id       int64
+		event    string
+		payload  string
+		attempts int
+		url      string
+		secret   string
+	}
+
+	results, err := db.Query(`
+		select d.id, d.event, d.payload, d.attempts, w.url, w.secret from webhook_deliveries d
+		join group_webhooks w on w.id = d.webhook_id
+		where d.failed = 0 and d.next_attempt <= ? order by d.id limit 100`, time.Now().Unix())
+	if err != nil {
+		logger.error("unable to read webhook queue", "error", err)
+		return
+	}
+	var deliveries []delivery
+	for results.Next() {
+		var thisDelivery delivery
+		if err = results.Scan(&thisDelivery.id, &thisDelivery.event, &thisDelivery.payload, &thisDelivery.attempts, &thisDelivery.url, &thisDelivery.secret); err != nil {
+			logger.error("unable to read webhook queue", "error", err)
+			break
+		}
+		deliveries = append(deliveries, thisDelivery)
+	}
+	results.Close()
+
+	for _, thisDelivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		err := postWebhook(thisDelivery.url, thisDelivery.secret, thisDelivery.id, thisDelivery.event, []byte(thisDelivery.payload))
+		if err == nil {
+			if _, err = db.Exec("DELETE FROM webhook_deliveries WHERE id = ?", thisDelivery.id); err != nil {
+				logger.error("unable to remove sent webhook delivery", "delivery_id", thisDelivery.id, "error", err)
+			}
+			continue
+		}
+
+		attempts := thisDelivery.attempts + 1
+		failed := attempts >= webhookMaxAttempts
+		delay := webhookRetryDelay << uint(attempts-1)
+		if delay > webhookMaxRetryDelay || delay <= 0 {
+			delay = webhookMaxRetryDelay
+		}
+		lastError := err.Error()
+		if len(lastError) > 255 {
+			lastError = lastError[:255]
+		}
+		if failed {
+			logger.warn("giving up on webhook delivery", "delivery_id", thisDelivery.id, "url", thisDelivery.url, "attempts", attempts, "error", lastError)
+		}
+		_, err = db.Exec("UPDATE webhook_deliveries SET attempts = ?, next_attempt = ?, last_error = ?, failed = ? WHERE id = ?",
+			attempts, time.Now().Unix()+int64(delay), lastError, failed, thisDelivery.id)
+		if err != nil {
+			logger.error("unable to update webhook delivery", "delivery_id", thisDelivery.id, "error", err)
+		}
+	}
+}
+
+// POST a json body, any status outside 2xx is an error
+func postJSON(client *http.Client, url string, body []byte, headers map[string]string) error {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "dmo-statservice")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s returned status %d", url, response.StatusCode)
+	}
+	return nil
+}
+
+func postWebhook(webhookURL string, secret string, id int64, event string, body []byte) error {
+	timestamp := time.Now().Unix()
+	return postJSON(webhookClient, webhookURL, body, map[string]string{
+		"X-DMO-Event":     event,
+		"X-DMO-Delivery":  strconv.FormatInt(id, 10),
+		"X-DMO-Timestamp": strconv.FormatInt(timestamp, 10),
+		"X-DMO-Signature": signWebhookPayload(secret, timestamp, body),
+	})
+}
+
+func validateWebhookURL(webhookURL string) error {
+	if len(webhookURL) > 512 {
+		return fmt.Errorf("webhook urls must be at most 512 characters")
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook urls must be absolute http or https urls")
+	}
+	return nil
+}
+
+func listGroupWebhooksRPC(c *gin.Context) {
+	name := c.Param("name")
+	if _, ok := getAddrGroup(name); !ok {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, listGroupWebhooks(name))
+}
+
+// Accept json request like:
+// {"URL": "https://example.com/dmo-hook"}
+// The response includes the signing secret, it is not shown again
+func createGroupWebhookRPC(c *gin.Context) {
+	var jsonBody struct {
+		URL string
+	}
+	if err := c.ShouldBindJSON(&jsonBody); err != nil {
+		abortWithBindError(c, err)
+		return
+	}
+
+	webhook, ok := createGroupWebhookRequest(c, c.Param("name"), jsonBody.URL)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// Validate and save a webhook from a request. On a bad request the error response has already
+// been sent and ok is false.
+func createGroupWebhookRequest(c *gin.Context, name string, webhookURL string) (GroupWebhook, bool) {
+	if _, ok := getAddrGroup(name); !ok {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "group not found")
+		return GroupWebhook{}, false
+	}
+	webhookURL = strings.TrimSpace(webhookURL)
+	if err := validateWebhookURL(webhookURL); err != nil {
+		abortWithError(c, http.StatusBadRequest, errCodeBadRequest, err.Error())
+		return GroupWebhook{}, false
+	}
+	if len(listGroupWebhooks(name)) >= maxWebhooksPerGroup {
+		abortWithError(c, http.StatusBadRequest, errCodeBadRequest, fmt.Sprintf("groups can have at most %d webhooks", maxWebhooksPerGroup))
+		return GroupWebhook{}, false
+	}
+
+	webhook, err := createGroupWebhook(name, webhookURL)
+	if err != nil {
+		requestLog(c).error("unable to save webhook", "group", name, "error", err)
+		abortWithError(c, http.StatusInternalServerError, errCodeInternal, "unable to save webhook")
+		return webhook, false
+	}
+	return webhook, true
+}
+
+func deleteGroupWebhookRPC(c *gin.Context) {
+	name := c.Param("name")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "webhook not found")
+		return
+	}
+
+	deleted, err := deleteGroupWebhook(name, id)
+	if err != nil {
+		requestLog(c).error("unable to delete webhook", "webhook_id", id, "error", err)
+		abortWithError(c, http.StatusInternalServerError, errCodeInternal, "unable to delete webhook")
+		return
+	}
+	if !deleted {
+		abortWithError(c, http.StatusNotFound, errCodeNotFound, "webhook not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}